@@ -0,0 +1,351 @@
+package napnap
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMultipartMemory = 32 << 20 // 32 MB
+)
+
+// Sources of request values
+const (
+	SourceQuery  = "query"
+	SourceParam  = "path"
+	SourceForm   = "form"
+	SourceHeader = "header"
+)
+
+var (
+	// ErrValueMissing is returned when the request value doesn't exist.
+	ErrValueMissing = errors.New("value is missing")
+)
+
+// ParamError is returned when a request value is missing or can't be parsed.
+// It names the parameter, so the message can be returned to the client directly.
+type ParamError struct {
+	// Source is where the value comes from, such as query, path, form or header.
+	Source string
+	// Name is the name of the parameter.
+	Name string
+	// Value is the raw value of the parameter.
+	Value string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *ParamError) Error() string {
+	if e.Err == ErrValueMissing {
+		return e.Source + " parameter \"" + e.Name + "\" is missing"
+	}
+	return "invalid " + e.Source + " parameter \"" + e.Name + "\": " + strconv.Quote(e.Value) + " " + e.reason()
+}
+
+func (e *ParamError) reason() string {
+	var numErr *strconv.NumError
+	if errors.As(e.Err, &numErr) {
+		if numErr.Err == strconv.ErrRange {
+			return "is out of range"
+		}
+		switch numErr.Func {
+		case "ParseFloat":
+			return "is not a valid number"
+		case "ParseBool":
+			return "is not a valid boolean"
+		}
+		return "is not a valid integer"
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns 400 (Bad Request) because the request contains invalid values.
+func (e *ParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func (c *Context) queryValue(key string) string {
+	return c.queryValues().Get(key)
+}
+
+// QueryArray returns all values of the query parameter, such as `?id=1&id=2`.
+func (c *Context) QueryArray(key string) []string {
+	return c.queryValues()[key]
+}
+
+// QueryArrayOrDefault returns all values of the query parameter.  If the parameter doesn't exist, the default value will be used.
+func (c *Context) QueryArrayOrDefault(key string, defaultValue []string) []string {
+	if values := c.QueryArray(key); len(values) > 0 {
+		return values
+	}
+	return defaultValue
+}
+
+// QueryMap returns the query parameters which look like `filter[status]=paid&filter[type]=online` as a map.
+func (c *Context) QueryMap(key string) map[string]string {
+	var result map[string]string
+	for k, values := range c.queryValues() {
+		if len(values) == 0 || len(k) <= len(key)+2 || !strings.HasPrefix(k, key+"[") || k[len(k)-1] != ']' {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]string)
+		}
+		result[k[len(key)+1:len(k)-1]] = values[0]
+	}
+	return result
+}
+
+// QueryMapOrDefault returns the query parameters which look like `filter[status]=paid` as a map.
+// If no parameter exists, the default value will be used.
+func (c *Context) QueryMapOrDefault(key string, defaultValue map[string]string) map[string]string {
+	if result := c.QueryMap(key); len(result) > 0 {
+		return result
+	}
+	return defaultValue
+}
+
+// QueryIntOrDefault returns query parameter by key and cast the value to int.  If the value doesn't exist, the default value will be used.
+func (c *Context) QueryIntOrDefault(key string, defaultValue int) (int, error) {
+	data := c.queryValue(key)
+	if len(data) == 0 {
+		return defaultValue, nil
+	}
+	return parseInt(SourceQuery, key, data)
+}
+
+// QueryInt64 returns query parameter by key and cast the value to int64.
+func (c *Context) QueryInt64(key string) (int64, error) {
+	return parseInt64(SourceQuery, key, c.queryValue(key))
+}
+
+// QueryInt64OrDefault returns query parameter by key and cast the value to int64.  If the value doesn't exist, the default value will be used.
+func (c *Context) QueryInt64OrDefault(key string, defaultValue int64) (int64, error) {
+	data := c.queryValue(key)
+	if len(data) == 0 {
+		return defaultValue, nil
+	}
+	return parseInt64(SourceQuery, key, data)
+}
+
+// QueryBool returns query parameter by key and cast the value to bool.
+// 1, t, true, on, yes, 0, f, false, off and no are accepted and the comparison is case insensitive.
+func (c *Context) QueryBool(key string) (bool, error) {
+	return parseBool(SourceQuery, key, c.queryValue(key))
+}
+
+// QueryBoolOrDefault returns query parameter by key and cast the value to bool.  If the value doesn't exist, the default value will be used.
+func (c *Context) QueryBoolOrDefault(key string, defaultValue bool) (bool, error) {
+	data := c.queryValue(key)
+	if len(data) == 0 {
+		return defaultValue, nil
+	}
+	return parseBool(SourceQuery, key, data)
+}
+
+// QueryFloat returns query parameter by key and cast the value to float64.
+func (c *Context) QueryFloat(key string) (float64, error) {
+	return parseFloat(SourceQuery, key, c.queryValue(key))
+}
+
+// QueryFloatOrDefault returns query parameter by key and cast the value to float64.  If the value doesn't exist, the default value will be used.
+func (c *Context) QueryFloatOrDefault(key string, defaultValue float64) (float64, error) {
+	data := c.queryValue(key)
+	if len(data) == 0 {
+		return defaultValue, nil
+	}
+	return parseFloat(SourceQuery, key, data)
+}
+
+// QueryDuration returns query parameter by key and cast the value to time.Duration, such as `30s` or `1h30m`.
+func (c *Context) QueryDuration(key string) (time.Duration, error) {
+	return parseDuration(SourceQuery, key, c.queryValue(key))
+}
+
+// QueryDurationOrDefault returns query parameter by key and cast the value to time.Duration.  If the value doesn't exist, the default value will be used.
+func (c *Context) QueryDurationOrDefault(key string, defaultValue time.Duration) (time.Duration, error) {
+	data := c.queryValue(key)
+	if len(data) == 0 {
+		return defaultValue, nil
+	}
+	return parseDuration(SourceQuery, key, data)
+}
+
+// QueryTime returns query parameter by key and parses the value with the layout, such as time.RFC3339.
+func (c *Context) QueryTime(key string, layout string) (time.Time, error) {
+	return parseTime(SourceQuery, key, c.queryValue(key), layout)
+}
+
+// QueryTimeOrDefault returns query parameter by key and parses the value with the layout.  If the value doesn't exist, the default value will be used.
+func (c *Context) QueryTimeOrDefault(key string, layout string, defaultValue time.Time) (time.Time, error) {
+	data := c.queryValue(key)
+	if len(data) == 0 {
+		return defaultValue, nil
+	}
+	return parseTime(SourceQuery, key, data, layout)
+}
+
+// ParamIntOrDefault returns parameter by key and cast the value to int.  If the value doesn't exist, the default value will be used.
+func (c *Context) ParamIntOrDefault(key string, defaultValue int) (int, error) {
+	data := c.Param(key)
+	if len(data) == 0 {
+		return defaultValue, nil
+	}
+	return parseInt(SourceParam, key, data)
+}
+
+// ParamUUID returns parameter by key and validates the value is an uuid.  The uuid is returned in lower case.
+func (c *Context) ParamUUID(key string) (string, error) {
+	return parseUUID(SourceParam, key, c.Param(key))
+}
+
+// ParamUUIDOrDefault returns parameter by key and validates the value is an uuid.  If the value doesn't exist, the default value will be used.
+func (c *Context) ParamUUIDOrDefault(key string, defaultValue string) (string, error) {
+	data := c.Param(key)
+	if len(data) == 0 {
+		return defaultValue, nil
+	}
+	return parseUUID(SourceParam, key, data)
+}
+
+// FormArray returns all values of the form parameter, such as checkboxes with the same name.
+func (c *Context) FormArray(key string) []string {
+	req := c.Request
+	if req.PostForm == nil {
+		_ = req.ParseMultipartForm(defaultMultipartMemory)
+	}
+	if values := req.PostForm[key]; len(values) > 0 {
+		return values
+	}
+	if req.MultipartForm != nil {
+		return req.MultipartForm.Value[key]
+	}
+	return nil
+}
+
+// FormArrayOrDefault returns all values of the form parameter.  If the parameter doesn't exist, the default value will be used.
+func (c *Context) FormArrayOrDefault(key string, defaultValue []string) []string {
+	if values := c.FormArray(key); len(values) > 0 {
+		return values
+	}
+	return defaultValue
+}
+
+// HeaderValues returns all values of the request header.  Comma separated values are not split.
+func (c *Context) HeaderValues(key string) []string {
+	return c.Request.Header.Values(key)
+}
+
+// HeaderValuesOrDefault returns all values of the request header.  If the header doesn't exist, the default value will be used.
+func (c *Context) HeaderValuesOrDefault(key string, defaultValue []string) []string {
+	if values := c.HeaderValues(key); len(values) > 0 {
+		return values
+	}
+	return defaultValue
+}
+
+func parseInt(source, name, value string) (int, error) {
+	if len(value) == 0 {
+		return 0, &ParamError{Source: source, Name: name, Err: ErrValueMissing}
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &ParamError{Source: source, Name: name, Value: value, Err: err}
+	}
+	return result, nil
+}
+
+func parseInt64(source, name, value string) (int64, error) {
+	if len(value) == 0 {
+		return 0, &ParamError{Source: source, Name: name, Err: ErrValueMissing}
+	}
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, &ParamError{Source: source, Name: name, Value: value, Err: err}
+	}
+	return result, nil
+}
+
+func parseFloat(source, name, value string) (float64, error) {
+	if len(value) == 0 {
+		return 0, &ParamError{Source: source, Name: name, Err: ErrValueMissing}
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, &ParamError{Source: source, Name: name, Value: value, Err: err}
+	}
+	return result, nil
+}
+
+func parseBool(source, name, value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return false, &ParamError{Source: source, Name: name, Err: ErrValueMissing}
+	case "1", "t", "true", "on", "yes":
+		return true, nil
+	case "0", "f", "false", "off", "no":
+		return false, nil
+	}
+	return false, &ParamError{Source: source, Name: name, Value: value, Err: errors.New("is not a valid boolean")}
+}
+
+func parseDuration(source, name, value string) (time.Duration, error) {
+	if len(value) == 0 {
+		return 0, &ParamError{Source: source, Name: name, Err: ErrValueMissing}
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, &ParamError{Source: source, Name: name, Value: value, Err: errors.New("is not a valid duration")}
+	}
+	return result, nil
+}
+
+func parseTime(source, name, value, layout string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, &ParamError{Source: source, Name: name, Err: ErrValueMissing}
+	}
+	result, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, &ParamError{Source: source, Name: name, Value: value, Err: errors.New("doesn't match the layout " + strconv.Quote(layout))}
+	}
+	return result, nil
+}
+
+func parseUUID(source, name, value string) (string, error) {
+	if len(value) == 0 {
+		return "", &ParamError{Source: source, Name: name, Err: ErrValueMissing}
+	}
+	if !isUUID(value) {
+		return "", &ParamError{Source: source, Name: name, Value: value, Err: errors.New("is not a valid uuid")}
+	}
+	return strings.ToLower(value), nil
+}
+
+// isUUID reports whether the value is an uuid in the canonical 8-4-4-4-12 format.
+func isUUID(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if char != '-' {
+				return false
+			}
+		default:
+			if !((char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')) {
+				return false
+			}
+		}
+	}
+	return true
+}
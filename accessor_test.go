@@ -0,0 +1,107 @@
+package napnap
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextQueryAccessors(t *testing.T) {
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/orders?id=1&id=2&page=abc&size=20&total=9000000000&paid=on&rate=0.5&wait=1m30s&since=2020-07-31&filter[status]=paid&filter[type]=online&filter=x", nil)
+
+	assert.Equal(t, []string{"1", "2"}, c.QueryArray("id"))
+	assert.Equal(t, []string{"a"}, c.QueryArrayOrDefault("tag", []string{"a"}))
+	assert.Equal(t, map[string]string{"status": "paid", "type": "online"}, c.QueryMap("filter"))
+	assert.Equal(t, map[string]string{"a": "b"}, c.QueryMapOrDefault("sort", map[string]string{"a": "b"}))
+
+	size, err := c.QueryIntOrDefault("size", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, size)
+	limit, err := c.QueryIntOrDefault("limit", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, limit)
+
+	total, err := c.QueryInt64("total")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9000000000), total)
+
+	paid, err := c.QueryBool("paid")
+	assert.Nil(t, err)
+	assert.True(t, paid)
+	deleted, err := c.QueryBoolOrDefault("deleted", true)
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+
+	rate, err := c.QueryFloat("rate")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, rate)
+
+	wait, err := c.QueryDuration("wait")
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, wait)
+
+	since, err := c.QueryTime("since", "2006-01-02")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 7, 31, 0, 0, 0, 0, time.UTC), since)
+}
+
+func TestContextQueryAccessorErrors(t *testing.T) {
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/orders?page=abc&paid=maybe&since=yesterday", nil)
+
+	_, err := c.QueryInt("page")
+	assert.Equal(t, `invalid query parameter "page": "abc" is not a valid integer`, err.Error())
+	var paramErr *ParamError
+	assert.True(t, errors.As(err, &paramErr))
+	assert.Equal(t, "page", paramErr.Name)
+	assert.Equal(t, 400, paramErr.StatusCode())
+
+	_, err = c.QueryIntOrDefault("page", 1)
+	assert.Error(t, err)
+
+	_, err = c.QueryInt64("total")
+	assert.Equal(t, `query parameter "total" is missing`, err.Error())
+	assert.True(t, errors.Is(err, ErrValueMissing))
+
+	_, err = c.QueryBool("paid")
+	assert.Equal(t, `invalid query parameter "paid": "maybe" is not a valid boolean`, err.Error())
+
+	_, err = c.QueryTime("since", "2006-01-02")
+	assert.Equal(t, `invalid query parameter "since": "yesterday" doesn't match the layout "2006-01-02"`, err.Error())
+}
+
+func TestContextParamUUID(t *testing.T) {
+	c, _, _ := createTestContext()
+	c.params = []Param{{Key: "id", Value: "6BA7B810-9DAD-11D1-80B4-00C04FD430C8"}, {Key: "bad", Value: "6ba7b810"}}
+
+	id, err := c.ParamUUID("id")
+	assert.Nil(t, err)
+	assert.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", id)
+
+	_, err = c.ParamUUID("bad")
+	assert.Equal(t, `invalid path parameter "bad": "6ba7b810" is not a valid uuid`, err.Error())
+
+	id, err = c.ParamUUIDOrDefault("missing", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "default", id)
+}
+
+func TestContextFormArrayAndHeaderValues(t *testing.T) {
+	c, _, _ := createTestContext()
+	form := url.Values{"color": {"red", "blue"}}
+	c.Request, _ = http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c.Request.Header.Add("Accept-Language", "en")
+	c.Request.Header.Add("Accept-Language", "zh-TW")
+
+	assert.Equal(t, []string{"red", "blue"}, c.FormArray("color"))
+	assert.Equal(t, []string{"none"}, c.FormArrayOrDefault("size", []string{"none"}))
+	assert.Equal(t, []string{"en", "zh-TW"}, c.HeaderValues("Accept-Language"))
+	assert.Equal(t, []string{"gzip"}, c.HeaderValuesOrDefault("Accept-Encoding", []string{"gzip"}))
+}
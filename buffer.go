@@ -0,0 +1,179 @@
+package napnap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultBufferLimit = 64 << 10 // 64KB
+
+// Buffer wraps the handler so its response is held in memory up to limit bytes (default 64KB if limit <= 0).
+// Until the buffer is sent, the status and the headers can be changed, and an error which is returned by the handler
+// replaces the partial output with the response of ErrorHandler.  When the body exceeds the limit or the handler flushes,
+// the response is sent and the rest is streamed.
+func Buffer(limit int, h HandlerFunc) HandlerFunc {
+	if limit <= 0 {
+		limit = defaultBufferLimit
+	}
+	return func(c *Context) error {
+		w := c.Writer
+		bw := &bufferedWriter{
+			w:      w,
+			limit:  limit,
+			status: defaultStatus,
+			header: w.Header().Clone(),
+		}
+		c.Writer = bw
+		defer func() {
+			c.Writer = w
+		}()
+
+		if err := h(c); err != nil {
+			c.handleError(err)
+		}
+		bw.finish()
+		return nil
+	}
+}
+
+// bufferedWriter holds the response until it is finished, flushed or exceeds the limit.
+type bufferedWriter struct {
+	w           ResponseWriter
+	buf         bytes.Buffer
+	limit       int
+	status      int
+	wroteHeader bool
+	spilled     bool
+	// header is the snapshot of the headers before the handler, which is restored by discard.
+	header http.Header
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	return bw.w.Header()
+}
+
+func (bw *bufferedWriter) WriteHeader(statusCode int) {
+	if bw.spilled {
+		bw.w.WriteHeader(statusCode)
+		return
+	}
+	bw.status = statusCode
+	bw.wroteHeader = true
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	if !bw.spilled && bw.buf.Len()+len(b) > bw.limit {
+		if err := bw.spill(); err != nil {
+			return 0, err
+		}
+	}
+	if bw.spilled {
+		return bw.w.Write(b)
+	}
+	bw.wroteHeader = true
+	return bw.buf.Write(b)
+}
+
+// spill sends the status, the headers and the buffered body, so the rest of the response is streamed.
+func (bw *bufferedWriter) spill() error {
+	bw.spilled = true
+	bw.w.WriteHeader(bw.status)
+	if bw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := bw.w.Write(bw.buf.Bytes())
+	bw.buf.Reset()
+	return err
+}
+
+// discard drops the buffered response and restores the headers.  It returns false if the response was already sent.
+func (bw *bufferedWriter) discard() bool {
+	if bw.spilled {
+		return false
+	}
+	bw.buf.Reset()
+	bw.status = defaultStatus
+	bw.wroteHeader = false
+
+	header := bw.w.Header()
+	for k := range header {
+		delete(header, k)
+	}
+	for k, v := range bw.header {
+		header[k] = v
+	}
+	return true
+}
+
+// finish sends the buffered response with its Content-Length.
+func (bw *bufferedWriter) finish() {
+	if bw.spilled || !bw.wroteHeader {
+		return
+	}
+	if len(bw.w.Header().Get("Content-Length")) == 0 && bodyAllowedForStatus(bw.status) {
+		bw.w.Header().Set("Content-Length", strconv.Itoa(bw.buf.Len()))
+	}
+	_ = bw.spill()
+}
+
+// Flush implements the http.Flusher interface.  The buffered response is sent and the rest is streamed.
+func (bw *bufferedWriter) Flush() {
+	if !bw.spilled {
+		_ = bw.spill()
+	}
+	if flusher, ok := bw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface.  A connection can't be taken over by a buffered handler.
+func (bw *bufferedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("napnap: hijack: %w", http.ErrNotSupported)
+}
+
+func (bw *bufferedWriter) ContentLength() int {
+	return bw.w.ContentLength()
+}
+
+func (bw *bufferedWriter) BytesWritten() int64 {
+	return bw.w.BytesWritten()
+}
+
+func (bw *bufferedWriter) Status() int {
+	if bw.spilled {
+		return bw.w.Status()
+	}
+	return bw.status
+}
+
+// Written returns true when the response was sent, so it can't be changed anymore.
+func (bw *bufferedWriter) Written() bool {
+	return bw.spilled
+}
+
+func (bw *bufferedWriter) HeaderWrittenAt() time.Time {
+	return bw.w.HeaderWrittenAt()
+}
+
+func (bw *bufferedWriter) FirstByteAt() time.Time {
+	return bw.w.FirstByteAt()
+}
+
+func (bw *bufferedWriter) reset(writer http.ResponseWriter) ResponseWriter {
+	return bw.w.reset(writer)
+}
+
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
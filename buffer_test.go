@@ -0,0 +1,52 @@
+package napnap
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer(t *testing.T) {
+	nap := New()
+	nap.ErrorHandler = DefaultErrorHandler
+	nap.Get("/fail", Buffer(0, func(c *Context) error {
+		c.RespHeader("Content-Disposition", "attachment")
+		_, _ = c.Writer.Write([]byte("partial"))
+		return errors.New("database is down")
+	}))
+	nap.Get("/status", Buffer(0, func(c *Context) error {
+		_ = c.String(200, "created")
+		c.SetStatus(201)
+		c.RespHeader("X-Late", "true")
+		return nil
+	}))
+	nap.Get("/large", Buffer(4, func(c *Context) error {
+		_ = c.String(200, "streamed")
+		return errors.New("too late")
+	}))
+
+	req, _ := http.NewRequest("GET", "/fail", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, `{"code":500,"message":"Internal Server Error"}`, w.Body.String())
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+
+	req, _ = http.NewRequest("GET", "/status", nil)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "created", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("X-Late"))
+	assert.Equal(t, "7", w.Header().Get("Content-Length"))
+
+	// the limit was exceeded, so the response was already sent
+	req, _ = http.NewRequest("GET", "/large", nil)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "streamed", w.Body.String())
+}
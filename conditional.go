@@ -0,0 +1,139 @@
+package napnap
+
+// reference:
+// https://tools.ietf.org/html/rfc7232
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SetETag sets the ETag header of the response.  The tag is quoted if it isn't quoted yet.
+// A tag which already has the W/ prefix is weak.
+func (c *Context) SetETag(tag string, weak bool) {
+	if strings.HasPrefix(tag, "W/") {
+		tag = tag[2:]
+		weak = true
+	}
+	if !strings.HasPrefix(tag, `"`) {
+		tag = `"` + tag + `"`
+	}
+	if weak {
+		tag = "W/" + tag
+	}
+	c.Writer.Header().Set("ETag", tag)
+}
+
+// SetLastModified sets the Last-Modified header of the response.
+func (c *Context) SetLastModified(t time.Time) {
+	if t.IsZero() {
+		c.Writer.Header().Del("Last-Modified")
+		return
+	}
+	c.Writer.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// EvaluatePreconditions evaluates If-Match, If-Unmodified-Since, If-None-Match and If-Modified-Since
+// of the request against the ETag and Last-Modified headers of the response, in the order of RFC 7232 section 6.
+// It returns 304 (Not Modified), 412 (Precondition Failed) or 0 if the request should be processed.
+// The target resource is assumed to exist, so `*` matches even when no ETag was set.
+func (c *Context) EvaluatePreconditions() int {
+	req := c.Request
+	header := c.Writer.Header()
+	etag := header.Get("ETag")
+	lastModified, lastModifiedErr := http.ParseTime(header.Get("Last-Modified"))
+	hasLastModified := lastModifiedErr == nil
+	isSafe := req.Method == GET || req.Method == HEAD
+
+	// step 1 and 2
+	if ifMatch := req.Header.Get("If-Match"); len(ifMatch) > 0 {
+		if !matchETag(ifMatch, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := req.Header.Get("If-Unmodified-Since"); len(ius) > 0 && hasLastModified {
+		if t, err := http.ParseTime(ius); err == nil && lastModified.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	// step 3 and 4
+	if ifNoneMatch := req.Header.Get("If-None-Match"); len(ifNoneMatch) > 0 {
+		if matchETag(ifNoneMatch, etag, true) {
+			if isSafe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := req.Header.Get("If-Modified-Since"); len(ims) > 0 && isSafe && hasLastModified {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// IsFresh returns true if the cached representation of the client is still fresh, so the response can be 304 (Not Modified).
+// SetETag or SetLastModified must be called before.
+func (c *Context) IsFresh() bool {
+	return c.EvaluatePreconditions() == http.StatusNotModified
+}
+
+// NotModified evaluates the preconditions of the request and writes a 304 (Not Modified) or 412 (Precondition Failed)
+// response if the request shouldn't be processed.  It returns true if the response was written and the handler should stop.
+//
+//	c.SetETag(article.Version, false)
+//	if c.NotModified() {
+//		return nil
+//	}
+func (c *Context) NotModified() bool {
+	status := c.EvaluatePreconditions()
+	if status == 0 {
+		return false
+	}
+
+	header := c.Writer.Header()
+	if status == http.StatusNotModified {
+		// RFC 7232 section 4.1: a sender shouldn't generate representation metadata other than the validators
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		if len(header.Get("ETag")) > 0 {
+			header.Del("Last-Modified")
+		}
+	}
+	c.Writer.WriteHeader(status)
+	return true
+}
+
+// matchETag reports whether the header value (list of entity tags or `*`) matches the etag.
+// The weak comparison is used for If-None-Match and the strong comparison for If-Match.
+// `*` matches any current representation, even one without an ETag.
+func matchETag(headerValue, etag string, weakComparison bool) bool {
+	if strings.TrimSpace(headerValue) == "*" {
+		return true
+	}
+	if len(etag) == 0 {
+		return false
+	}
+	if !weakComparison && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(headerValue, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weakComparison {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
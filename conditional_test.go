@@ -0,0 +1,128 @@
+package napnap
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextSetETag(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	c.SetETag("v1", false)
+	assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+
+	c.SetETag(`"v2"`, true)
+	assert.Equal(t, `W/"v2"`, w.Header().Get("ETag"))
+
+	// weak tags are neither quoted nor prefixed again
+	c.SetETag(`W/"v3"`, false)
+	assert.Equal(t, `W/"v3"`, w.Header().Get("ETag"))
+	c.SetETag(`W/"v4"`, true)
+	assert.Equal(t, `W/"v4"`, w.Header().Get("ETag"))
+	c.SetETag("W/v5", false)
+	assert.Equal(t, `W/"v5"`, w.Header().Get("ETag"))
+}
+
+func TestContextIfNoneMatch(t *testing.T) {
+	c, w, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/articles", nil)
+	c.Request.Header.Set("If-None-Match", `"v0", W/"v1"`)
+	c.SetETag("v1", false)
+	c.RespHeader("Content-Type", "application/json")
+
+	assert.True(t, c.IsFresh())
+	assert.True(t, c.NotModified())
+	assert.Equal(t, 304, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Type"))
+
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/articles", nil)
+	c.Request.Header.Set("If-None-Match", `"v0"`)
+	c.SetETag("v1", false)
+	assert.False(t, c.NotModified())
+
+	c, w, _ = createTestContext()
+	c.Request, _ = http.NewRequest("PUT", "/articles/1", nil)
+	c.Request.Header.Set("If-None-Match", "*")
+	c.SetETag("v1", false)
+	assert.True(t, c.NotModified())
+	assert.Equal(t, 412, w.Code)
+}
+
+func TestContextIfMatch(t *testing.T) {
+	c, w, _ := createTestContext()
+	c.Request, _ = http.NewRequest("PUT", "/articles/1", nil)
+	c.Request.Header.Set("If-Match", `"v1"`)
+	c.SetETag("v2", false)
+	assert.Equal(t, 412, c.EvaluatePreconditions())
+	assert.True(t, c.NotModified())
+	assert.Equal(t, 412, w.Code)
+
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("PUT", "/articles/1", nil)
+	c.Request.Header.Set("If-Match", `"v1", "v2"`)
+	c.SetETag("v2", false)
+	assert.Equal(t, 0, c.EvaluatePreconditions())
+
+	// weak etags never match with the strong comparison
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("PUT", "/articles/1", nil)
+	c.Request.Header.Set("If-Match", `W/"v2"`)
+	c.SetETag("v2", true)
+	assert.Equal(t, 412, c.EvaluatePreconditions())
+
+	// `*` matches an existing resource without an etag
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("PUT", "/articles/1", nil)
+	c.Request.Header.Set("If-Match", "*")
+	assert.Equal(t, 0, c.EvaluatePreconditions())
+
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("PUT", "/articles/1", nil)
+	c.Request.Header.Set("If-None-Match", "*")
+	assert.Equal(t, 412, c.EvaluatePreconditions())
+}
+
+func TestContextIfModifiedSince(t *testing.T) {
+	lastModified := time.Date(2020, 7, 31, 10, 0, 0, 500, time.UTC)
+
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/articles", nil)
+	c.Request.Header.Set("If-Modified-Since", lastModified.Format(http.TimeFormat))
+	c.SetLastModified(lastModified)
+	assert.Equal(t, 304, c.EvaluatePreconditions())
+
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/articles", nil)
+	c.Request.Header.Set("If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat))
+	c.SetLastModified(lastModified)
+	assert.Equal(t, 0, c.EvaluatePreconditions())
+
+	// If-None-Match takes precedence over If-Modified-Since
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/articles", nil)
+	c.Request.Header.Set("If-None-Match", `"v0"`)
+	c.Request.Header.Set("If-Modified-Since", lastModified.Format(http.TimeFormat))
+	c.SetETag("v1", false)
+	c.SetLastModified(lastModified)
+	assert.Equal(t, 0, c.EvaluatePreconditions())
+}
+
+func TestContextIfUnmodifiedSince(t *testing.T) {
+	lastModified := time.Date(2020, 7, 31, 10, 0, 0, 0, time.UTC)
+
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("DELETE", "/articles/1", nil)
+	c.Request.Header.Set("If-Unmodified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat))
+	c.SetLastModified(lastModified)
+	assert.Equal(t, 412, c.EvaluatePreconditions())
+
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("DELETE", "/articles/1", nil)
+	c.Request.Header.Set("If-Unmodified-Since", lastModified.Format(http.TimeFormat))
+	c.SetLastModified(lastModified)
+	assert.Equal(t, 0, c.EvaluatePreconditions())
+}
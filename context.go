@@ -1,18 +1,21 @@
 package napnap
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"io/ioutil"
 	"mime/multipart"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
-	"strconv"
 	"strings"
+	"time"
 )
 
 // Param is a single URL parameter, consisting of a key and a value.
@@ -29,7 +32,17 @@ type Context struct {
 	Writer  ResponseWriter
 	query   url.Values
 	params  []Param
-	store   map[string]interface{}
+	store   map[interface{}]interface{}
+	session *Session
+	// released is set in debug mode when the context was returned after the request.
+	released bool
+	// detached is set when a handler timed out but still runs, so the context can't be recycled.
+	detached     bool
+	requestID    string
+	routePattern string
+	logger       Logger
+	// finishers are called after the middleware chain returned, before the context is recycled.
+	finishers []func()
 }
 
 // NewContext returns a new context instance
@@ -41,48 +54,101 @@ func NewContext(napnap *NapNap, req *http.Request, writer ResponseWriter) *Conte
 	}
 }
 
-// Render returns html format
+// Render renders the view with the renderer which is registered for its extension or the default renderer.
+// The view is rendered into memory first, so the status is only sent when rendering succeeded.
 func (c *Context) Render(code int, viewName string, data interface{}) error {
-	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	b, err := c.NapNap.RenderToBytes(viewName, data)
+	if err != nil {
+		return err
+	}
+	c.Writer.Header().Set("Content-Type", contentTypeOf(c.NapNap.rendererFor(viewName)))
 	c.Writer.WriteHeader(code)
+	_, err = c.Writer.Write(b)
+	return err
+}
 
-	t, err := c.NapNap.template.Clone()
+// String returns string format
+func (c *Context) String(code int, s string) error {
+	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	c.Writer.WriteHeader(code)
+	_, err := c.Writer.Write([]byte(s))
 	if err != nil {
 		return err
 	}
+	return nil
+}
 
-	viewPath := path.Join(c.NapNap.templateRootPath, "views", viewName)
-	t, err = t.ParseFiles(viewPath)
+// JSON returns json format
+func (c *Context) JSON(code int, i interface{}) error {
+	b, err := json.Marshal(i)
 	if err != nil {
 		return err
 	}
+	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.Writer.WriteHeader(code)
+	_, err = c.Writer.Write(b)
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
-	err = t.ExecuteTemplate(c.Writer, viewName, data)
+// JSONPretty returns json format with indentation which is easy for humans to read.
+func (c *Context) JSONPretty(code int, i interface{}, indent string) error {
+	b, err := json.MarshalIndent(i, "", indent)
+	if err != nil {
+		return err
+	}
+	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.Writer.WriteHeader(code)
+	_, err = c.Writer.Write(b)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// String returns string format
-func (c *Context) String(code int, s string) error {
-	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+// JSONP returns json format wrapped with the callback function for cross-domain requests.
+// The callback name must be a valid javascript identifier or the request will be rejected.
+func (c *Context) JSONP(code int, callback string, i interface{}) error {
+	if !isValidCallback(callback) {
+		return fmt.Errorf("napnap: invalid jsonp callback %q", callback)
+	}
+	b, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	c.Writer.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	c.Writer.Header().Set("X-Content-Type-Options", "nosniff")
 	c.Writer.WriteHeader(code)
-	_, err := c.Writer.Write([]byte(s))
+	// the leading comment prevents the response from being interpreted as a flash file (rosetta flash)
+	_, err = c.Writer.Write([]byte("/**/ " + callback + "("))
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.Write(b)
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.Write([]byte(");"))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// JSON returns json format
-func (c *Context) JSON(code int, i interface{}) error {
+// SecureJSON returns json format prefixed with `NapNap.SecureJSONPrefix` to prevent json hijacking.
+func (c *Context) SecureJSON(code int, i interface{}) error {
 	b, err := json.Marshal(i)
 	if err != nil {
 		return err
 	}
 	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
 	c.Writer.WriteHeader(code)
+	_, err = c.Writer.Write([]byte(c.NapNap.SecureJSONPrefix))
+	if err != nil {
+		return err
+	}
 	_, err = c.Writer.Write(b)
 	if err != nil {
 		return err
@@ -90,6 +156,76 @@ func (c *Context) JSON(code int, i interface{}) error {
 	return nil
 }
 
+// ASCIIJSON returns json format which only contains ascii characters.  Non-ascii characters are escaped to `\uXXXX`.
+func (c *Context) ASCIIJSON(code int, i interface{}) error {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(code)
+	_, err = c.Writer.Write(asciiEscape(b))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// JSONIterator returns the next element of a json array.  It returns false when there are no more elements.
+type JSONIterator func() (interface{}, bool, error)
+
+// JSONStream writes a json array element by element and flushes the data to the client periodically,
+// so a large result set doesn't need to be held in memory.
+// Once the first element was written, errors can't change the status code anymore and the array is left unterminated.
+func (c *Context) JSONStream(code int, next JSONIterator) error {
+	// fetch the first element before the header is committed, so the handler still has a chance to report an error.
+	val, ok, err := next()
+	if err != nil {
+		return err
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.Writer.WriteHeader(code)
+	_, err = c.Writer.Write([]byte("["))
+	if err != nil {
+		return err
+	}
+
+	for count := 0; ok; count++ {
+		if count > 0 {
+			_, err = c.Writer.Write([]byte(","))
+			if err != nil {
+				return err
+			}
+		}
+
+		b, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		_, err = c.Writer.Write(b)
+		if err != nil {
+			return err
+		}
+
+		if (count+1)%jsonStreamFlushSize == 0 {
+			c.flush()
+		}
+
+		val, ok, err = next()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.Writer.Write([]byte("]"))
+	if err != nil {
+		return err
+	}
+	c.flush()
+	return nil
+}
+
 // Redirect returns a HTTP redirect to the specific location.
 func (c *Context) Redirect(code int, location string) error {
 	if (code < 300 || code > 308) && code != 201 {
@@ -111,26 +247,78 @@ func (c *Context) BindJSON(obj interface{}) error {
 	return nil
 }
 
+// RequestID returns the id of the request which is set by the request id middleware.
+func (c *Context) RequestID() string {
+	return c.requestID
+}
+
+// SetRequestID sets the id of the request.  It is included in the output of the logger and DefaultErrorHandler.
+func (c *Context) SetRequestID(id string) {
+	c.requestID = id
+	c.logger = nil
+}
+
+// RoutePattern returns the pattern of the matched route, such as "/users/:id".  It is empty when no route matched,
+// so it can be used as a low cardinality label for logs and metrics.
+func (c *Context) RoutePattern() string {
+	return c.routePattern
+}
+
+// Copy returns a copy of the context which can be used safely by goroutines after the handler returns.
+// The request is cloned without its body, the context of the request is never canceled and the copy has no response writer.
+func (c *Context) Copy() *Context {
+	c.mustBeActive()
+	cp := &Context{
+		NapNap:       c.NapNap,
+		Writer:       NewResponseWriter().reset(detachedWriter{reason: "a copied context has no response writer"}),
+		requestID:    c.requestID,
+		routePattern: c.routePattern,
+	}
+	if c.Request != nil {
+		cp.Request = c.Request.Clone(context.WithoutCancel(c.Request.Context()))
+		cp.Request.Body = http.NoBody
+	}
+	if c.query != nil {
+		cp.query = make(url.Values, len(c.query))
+		for k, v := range c.query {
+			cp.query[k] = append([]string(nil), v...)
+		}
+	}
+	if c.params != nil {
+		cp.params = append([]Param(nil), c.params...)
+	}
+	if c.store != nil {
+		cp.store = make(map[interface{}]interface{}, len(c.store))
+		for k, v := range c.store {
+			cp.store[k] = v
+		}
+	}
+	return cp
+}
+
 // Query returns query parameter by key.
 func (c *Context) Query(key string) string {
+	return c.queryValues().Get(key)
+}
+
+func (c *Context) queryValues() url.Values {
+	c.mustBeActive()
 	if c.query == nil {
 		c.query = c.Request.URL.Query()
 	}
-	return c.query.Get(key)
+	return c.query
 }
 
 // QueryInt returns query parameter by key and cast the value to int.
 func (c *Context) QueryInt(key string) (int, error) {
-	return strconv.Atoi(c.Query(key))
+	return parseInt(SourceQuery, key, c.Query(key))
 }
 
 // QueryIntWithDefault returns query parameter by key and cast the value to int.  If the value doesn't exist, the default value will be used.
+//
+// Deprecated: use QueryIntOrDefault instead.
 func (c *Context) QueryIntWithDefault(key string, defaultValue int) (int, error) {
-	data := c.Query(key)
-	if len(data) > 0 {
-		return strconv.Atoi(c.Query(key))
-	}
-	return defaultValue, nil
+	return c.QueryIntOrDefault(key, defaultValue)
 }
 
 // Form returns form parameter by key.
@@ -147,7 +335,7 @@ func (c *Context) Form(key string) string {
 	return ""
 }
 
-// FormFile returns file.
+// FormFile returns file.  The whole multipart body is parsed first, use ReceiveFiles for large uploads.
 func (c *Context) FormFile(key string) (*multipart.FileHeader, error) {
 	_, fh, err := c.Request.FormFile(key)
 	return fh, err
@@ -180,8 +368,130 @@ func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) (err
 	return nil
 }
 
+// File sends the content of the file to the client.  Range, If-Modified-Since and HEAD requests are handled as well.
+// A missing file returns an error with the status 404 which still matches fs.ErrNotExist.
+func (c *Context) File(filepath string) error {
+	f, fi, err := openFile(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	http.ServeContent(c.Writer, c.Request, fi.Name(), fi.ModTime(), f)
+	return nil
+}
+
+// openFile opens the file which is sent to the client.
+func openFile(filepath string) (*os.File, fs.FileInfo, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, nil, fileError(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, nil, fmt.Errorf("napnap: %s is a directory", filepath)
+	}
+	return f, fi, nil
+}
+
+// fileError maps a missing file to 404.
+func fileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return &HTTPError{Code: http.StatusNotFound, Message: http.StatusText(http.StatusNotFound), Err: err}
+	}
+	return err
+}
+
+// FileFS sends the content of the file from the file system to the client.
+// Range, If-Modified-Since and HEAD requests are handled as well.
+func (c *Context) FileFS(fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return fileError(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("napnap: %s is a directory", name)
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		// files of some file systems can't seek, so the content is read into memory.
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	}
+
+	http.ServeContent(c.Writer, c.Request, fi.Name(), fi.ModTime(), content)
+	return nil
+}
+
+// Attachment sends the file as an attachment, so browsers will prompt the user to download it with the download name.
+// If the download name is empty, the name of the file is used.
+func (c *Context) Attachment(filepath string, downloadName string) error {
+	return c.contentDisposition("attachment", filepath, downloadName)
+}
+
+// Inline sends the file which browsers will display in the page when possible.
+// If the name is empty, the name of the file is used.
+func (c *Context) Inline(filepath string, name string) error {
+	return c.contentDisposition("inline", filepath, name)
+}
+
+func (c *Context) contentDisposition(dispositionType, filepath, name string) error {
+	if len(name) == 0 {
+		name = path.Base(strings.ReplaceAll(filepath, "\\", "/"))
+	}
+	// the header is only set when the file exists, so error responses aren't downloaded
+	f, fi, err := openFile(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.Writer.Header().Set("Content-Disposition", encodeContentDisposition(dispositionType, name))
+	http.ServeContent(c.Writer, c.Request, fi.Name(), fi.ModTime(), f)
+	return nil
+}
+
+// Stream sends the content of the reader to the client.  If the reader is an io.ReadSeeker and the code is 200,
+// range requests are supported.  The body isn't sent for HEAD requests.
+func (c *Context) Stream(code int, contentType string, r io.Reader) error {
+	if len(contentType) > 0 {
+		c.Writer.Header().Set("Content-Type", contentType)
+	}
+
+	if rs, ok := r.(io.ReadSeeker); ok && code == http.StatusOK {
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, rs)
+		return nil
+	}
+
+	c.Writer.WriteHeader(code)
+	if c.Request != nil && c.Request.Method == HEAD {
+		return nil
+	}
+	_, err := io.Copy(c.Writer, r)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // Get retrieves data from the context.
 func (c *Context) Get(key string) (interface{}, bool) {
+	c.mustBeActive()
 	var value interface{}
 	var exists bool
 	if c.store != nil {
@@ -201,14 +511,16 @@ func (c *Context) MustGet(key string) interface{} {
 // Set saves data in the context.
 // It also lazy initializes  c.Keys if it was not used previously.
 func (c *Context) Set(key string, val interface{}) {
+	c.mustBeActive()
 	if c.store == nil {
-		c.store = make(map[string]interface{})
+		c.store = make(map[interface{}]interface{})
 	}
 	c.store[key] = val
 }
 
 // Param returns form values by parameter
 func (c *Context) Param(name string) string {
+	c.mustBeActive()
 	for _, param := range c.params {
 		if param.Key == name {
 			return param.Value
@@ -219,33 +531,7 @@ func (c *Context) Param(name string) string {
 
 // ParamInt returns parameter by key and cast the value to int.
 func (c *Context) ParamInt(key string) (int, error) {
-	return strconv.Atoi(c.Param(key))
-}
-
-// ClientIP implements a best effort algorithm to return the real client IP, it parses
-// X-Real-IP and X-Forwarded-For in order to work properly with reverse-proxies such us: nginx or haproxy.
-// Use X-Forwarded-For before X-Real-Ip as nginx uses X-Real-Ip with the proxy's IP.
-func (c *Context) ClientIP() string {
-	clientIP := c.RequestHeader("X-Forwarded-For")
-	if index := strings.IndexByte(clientIP, ','); index >= 0 {
-		clientIP = clientIP[0:index]
-	}
-	clientIP = strings.TrimSpace(clientIP)
-	if len(clientIP) > 0 {
-		return clientIP
-	}
-	clientIP = strings.TrimSpace(c.RequestHeader("X-Real-Ip"))
-	if len(clientIP) > 0 {
-		return clientIP
-	}
-	clientIP = strings.TrimSpace(clientIP)
-	if len(clientIP) > 0 {
-		return clientIP
-	}
-	if ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr)); err == nil {
-		return ip
-	}
-	return ""
+	return parseInt(SourceParam, key, c.Param(key))
 }
 
 // ContentType returns the Content-Type header of the request.
@@ -254,6 +540,8 @@ func (c *Context) ContentType() string {
 }
 
 // SetCookie allows us to create an cookie
+//
+// Deprecated: use SetCookieWithOptions instead which supports all cookie attributes.
 func (c *Context) SetCookie(
 	name string,
 	value string,
@@ -263,12 +551,7 @@ func (c *Context) SetCookie(
 	secure bool,
 	httpOnly bool,
 ) {
-	if path == "" {
-		path = "/"
-	}
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     name,
-		Value:    url.QueryEscape(value),
+	c.SetCookieWithOptions(name, value, &CookieOptions{
 		MaxAge:   maxAge,
 		Path:     path,
 		Domain:   domain,
@@ -301,6 +584,7 @@ func (c *Context) Status() int {
 // It writes a header in the response.
 // If value == "", this method removes the header `c.Writer.Header().Del(key)`
 func (c *Context) RespHeader(key, value string) {
+	c.mustBeActive()
 	if len(value) == 0 {
 		c.Writer.Header().Del(key)
 	} else {
@@ -310,11 +594,14 @@ func (c *Context) RespHeader(key, value string) {
 
 // RequestHeader is a intelligent shortcut for c.Request.Header.Get(key)
 func (c *Context) RequestHeader(key string) string {
+	c.mustBeActive()
 	return c.Request.Header.Get(key)
 }
 
-// StdContext return golang standard context
+// StdContext return golang standard context.  The values of SetValue which were set before it was created can be read
+// from it with Value.
 func (c *Context) StdContext() context.Context {
+	c.mustBeActive()
 	ctx := c.Request.Context()
 	ctx = newGContext(ctx, c)
 	return ctx
@@ -358,10 +645,49 @@ func (c *Context) DeviceType() string {
 	return deviceType
 }
 
+func (c *Context) flush() {
+	if f, ok := c.Writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// mustBeActive panics when a released context is used in debug mode, so the request of another client is never read or written.
+func (c *Context) mustBeActive() {
+	if c.released {
+		panic("napnap: the context was used after the request was finished; use Context.Copy() to pass it to a goroutine")
+	}
+}
+
+// release marks the context as finished in debug mode.  The context is never recycled, so later use can be detected.
+func (c *Context) release() {
+	c.released = true
+	c.Writer = NewResponseWriter().reset(detachedWriter{reason: "the response was written after the request was finished"})
+}
+
+// onFinish registers a function which is called when the request is finished, such as to stop goroutines which hold the context.
+func (c *Context) onFinish(fn func()) {
+	c.finishers = append(c.finishers, fn)
+}
+
+// finish calls the functions which were registered by onFinish in reverse order.
+func (c *Context) finish() {
+	for i := len(c.finishers) - 1; i >= 0; i-- {
+		c.finishers[i]()
+	}
+	c.finishers = nil
+}
+
 func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
 	c.Request = req
 	c.Writer = c.Writer.reset(w)
 	c.store = nil
 	c.query = nil
 	c.params = nil
+	c.session = nil
+	c.released = false
+	c.detached = false
+	c.requestID = ""
+	c.routePattern = ""
+	c.logger = nil
+	c.finishers = nil
 }
@@ -1,29 +1,38 @@
 package napnap
 
 import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestContextRemoteIpAddress(t *testing.T) {
-	c, _, _ := createTestContext()
+	c, _, nap := createTestContext()
+	nap.TrustedProxies = []string{"40.40.40.0/24"}
 
 	c.Request, _ = http.NewRequest("POST", "/", nil)
+	c.Request.RemoteAddr = "  40.40.40.40:42123 "
 
 	c.Request.Header.Set("X-Real-IP", " 10.10.10.10  ")
 	assert.Equal(t, "10.10.10.10", c.ClientIP())
 	c.Request.Header.Del("X-Real-IP")
 
 	c.Request.Header.Set("X-Forwarded-For", "  20.20.20.20, 30.30.30.30")
-	assert.Equal(t, "20.20.20.20", c.ClientIP())
+	assert.Equal(t, "30.30.30.30", c.ClientIP())
 	c.Request.Header.Set("X-Forwarded-For", "30.30.30.30  ")
 	assert.Equal(t, "30.30.30.30", c.ClientIP())
 
 	c.Request.Header.Del("X-Forwarded-For")
-
-	c.Request.RemoteAddr = "  40.40.40.40:42123 "
 	assert.Equal(t, "40.40.40.40", c.ClientIP())
 }
 
@@ -139,3 +148,242 @@ func TestContextSetGetValues(t *testing.T) {
 // 	assert.Equal(t, "Hello NapNap", w.Body.String())
 // 	assert.Equal(t, "text/html; charset=utf-8", w.HeaderMap.Get("Content-Type"))
 // }
+
+func TestContextJSONPretty(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	err := c.JSONPretty(201, map[string]string{"name": "napnap"}, "  ")
+	assert.Nil(t, err)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "{\n  \"name\": \"napnap\"\n}", w.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestContextJSONP(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	err := c.JSONP(200, "jQuery.cb_1", map[string]string{"name": "napnap"})
+	assert.Nil(t, err)
+	assert.Equal(t, `/**/ jQuery.cb_1({"name":"napnap"});`, w.Body.String())
+	assert.Equal(t, "application/javascript; charset=utf-8", w.Header().Get("Content-Type"))
+
+	c, _, _ = createTestContext()
+	assert.Error(t, c.JSONP(200, "alert(1);cb", nil))
+	assert.Error(t, c.JSONP(200, "1cb", nil))
+	assert.Error(t, c.JSONP(200, "cb.", nil))
+}
+
+func TestContextSecureJSON(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	err := c.SecureJSON(200, []string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, `while(1);["a","b"]`, w.Body.String())
+}
+
+func TestContextASCIIJSON(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	err := c.ASCIIJSON(200, map[string]string{"lang": "GO語言", "emoji": "😀"})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"emoji":"\ud83d\ude00","lang":"GO\u8a9e\u8a00"}`, w.Body.String())
+}
+
+func TestContextJSONStream(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	count := 0
+	err := c.JSONStream(200, func() (interface{}, bool, error) {
+		if count == 250 {
+			return nil, false, nil
+		}
+		count++
+		return count, true, nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, w.Flushed)
+
+	var result []int
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Len(t, result, 250)
+	assert.Equal(t, 250, result[249])
+
+	c, w, _ = createTestContext()
+	err = c.JSONStream(200, func() (interface{}, bool, error) {
+		return nil, false, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "[]", w.Body.String())
+
+	c, w, _ = createTestContext()
+	err = c.JSONStream(200, func() (interface{}, bool, error) {
+		return nil, false, errors.New("oops")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, w.Body.Len())
+	assert.False(t, w.Flushed)
+}
+
+func TestContextFile(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "hello.txt")
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("hello napnap"), 0644))
+
+	c, w, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/hello.txt", nil)
+	assert.Nil(t, c.File(filePath))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "hello napnap", w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	lastModified := w.Header().Get("Last-Modified")
+
+	c, w, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/hello.txt", nil)
+	c.Request.Header.Set("Range", "bytes=6-")
+	assert.Nil(t, c.File(filePath))
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "napnap", w.Body.String())
+
+	c, w, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/hello.txt", nil)
+	c.Request.Header.Set("If-Modified-Since", lastModified)
+	assert.Nil(t, c.File(filePath))
+	assert.Equal(t, 304, w.Code)
+
+	c, w, _ = createTestContext()
+	c.Request, _ = http.NewRequest("HEAD", "/hello.txt", nil)
+	assert.Nil(t, c.File(filePath))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "12", w.Header().Get("Content-Length"))
+	assert.Equal(t, 0, w.Body.Len())
+
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	assert.Error(t, c.File(dir))
+}
+
+func TestContextFileFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"static/app.js": &fstest.MapFile{Data: []byte("console.log(1)"), ModTime: time.Now()},
+	}
+
+	c, w, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/app.js", nil)
+	c.Request.Header.Set("Range", "bytes=0-6")
+	assert.Nil(t, c.FileFS(fsys, "static/app.js"))
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "console", w.Body.String())
+
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/app.js", nil)
+	err := c.FileFS(fsys, "static/missing.js")
+	var httpErr *HTTPError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode())
+}
+
+func TestContextAttachment(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "report.csv")
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("a,b"), 0644))
+
+	c, w, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/download", nil)
+	assert.Nil(t, c.Attachment(filePath, ""))
+	assert.Equal(t, `attachment; filename="report.csv"`, w.Header().Get("Content-Disposition"))
+
+	c, w, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/download", nil)
+	assert.Nil(t, c.Attachment(filePath, "月報 2020.csv"))
+	assert.Equal(t, `attachment; filename="__ 2020.csv"; filename*=UTF-8''%E6%9C%88%E5%A0%B1%202020.csv`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "a,b", w.Body.String())
+
+	c, w, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/download", nil)
+	assert.Nil(t, c.Inline(filePath, `say "hi".csv`))
+	assert.Equal(t, `inline; filename="say _hi_.csv"; filename*=UTF-8''say%20%22hi%22.csv`, w.Header().Get("Content-Disposition"))
+
+	// a missing file is 404 and the error response isn't an attachment
+	nap := New()
+	nap.ErrorHandler = DefaultErrorHandler
+	nap.Get("/download", func(c *Context) error {
+		return c.Attachment(filepath.Join(dir, "missing.csv"), "a.txt")
+	})
+	req, _ := http.NewRequest("GET", "/download", nil)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+
+	err := c.Attachment(filepath.Join(dir, "missing.csv"), "")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestContextStream(t *testing.T) {
+	c, w, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/stream", nil)
+	assert.Nil(t, c.Stream(201, "text/csv", strings.NewReader("a,b\n1,2")))
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "a,b\n1,2", w.Body.String())
+
+	c, w, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/stream", nil)
+	c.Request.Header.Set("Range", "bytes=4-")
+	assert.Nil(t, c.Stream(200, "text/csv", strings.NewReader("a,b\n1,2")))
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "1,2", w.Body.String())
+
+	c, w, _ = createTestContext()
+	c.Request, _ = http.NewRequest("HEAD", "/stream", nil)
+	assert.Nil(t, c.Stream(200, "text/csv", ioutil.NopCloser(strings.NewReader("a,b"))))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 0, w.Body.Len())
+}
+
+func TestContextCopy(t *testing.T) {
+	nap := New()
+	var copies []*Context
+	nap.Get("/users/:id", func(c *Context) error {
+		c.Set("user", "user"+c.Param("id"))
+		copies = append(copies, c.Copy())
+		return c.String(200, "ok")
+	})
+
+	req, _ := http.NewRequest("GET", "/users/1?sort=name", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	// the second request reuses the pooled context of the first one
+	req, _ = http.NewRequest("GET", "/users/2?sort=age", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+
+	first := copies[0]
+	assert.Equal(t, "1", first.Param("id"))
+	assert.Equal(t, "name", first.Query("sort"))
+	assert.Equal(t, "user1", first.MustGet("user"))
+	assert.Equal(t, "/users/1", first.Request.URL.Path)
+	assert.Nil(t, first.StdContext().Err())
+	assert.Panics(t, func() { _ = first.String(200, "late") })
+
+	second := copies[1]
+	assert.Equal(t, "2", second.Param("id"))
+	assert.Equal(t, "age", second.Query("sort"))
+	assert.Equal(t, "user2", second.MustGet("user"))
+}
+
+func TestContextUseAfterRelease(t *testing.T) {
+	nap := New()
+	nap.Debug = true
+	var leaked *Context
+	nap.Get("/users/:id", func(c *Context) error {
+		leaked = c
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.PanicsWithValue(t, "napnap: the context was used after the request was finished; use Context.Copy() to pass it to a goroutine", func() {
+		leaked.Param("id")
+	})
+	assert.Panics(t, func() { _ = leaked.String(200, "late") })
+}
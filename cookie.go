@@ -0,0 +1,272 @@
+package napnap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minCookieSecretSize = 32
+)
+
+var (
+	// ErrKeyRingRequired is returned when signed or encrypted cookies are used without NapNap.CookieKeys.
+	ErrKeyRingRequired = errors.New("napnap: NapNap.CookieKeys is required for signed and encrypted cookies")
+	// ErrInvalidCookie is returned when the cookie was tampered, expired or can't be decrypted by any key.
+	ErrInvalidCookie = errors.New("napnap: cookie is invalid")
+)
+
+// CookieOptions configures the attributes of a cookie.
+type CookieOptions struct {
+	// Path of the cookie.  Default value is "/"
+	Path   string
+	Domain string
+	// MaxAge=0 means no Max-Age attribute specified.
+	// MaxAge<0 means delete cookie now.
+	// MaxAge>0 means Max-Age attribute present and given in seconds.
+	MaxAge   int
+	Expires  time.Time
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+	// Partitioned stores the cookie in partitioned storage (CHIPS).  It requires Secure.
+	Partitioned bool
+}
+
+func (opts *CookieOptions) expiration() time.Time {
+	if opts.MaxAge > 0 {
+		return time.Now().Add(time.Duration(opts.MaxAge) * time.Second)
+	}
+	return opts.Expires
+}
+
+// KeyRing holds the secrets for signed and encrypted cookies.  The first secret is used to sign and encrypt
+// new cookies and all secrets are tried when cookies are verified, so secrets can be rotated by prepending a new one.
+type KeyRing struct {
+	keys []cookieKey
+}
+
+type cookieKey struct {
+	signKey []byte
+	aead    cipher.AEAD
+}
+
+// NewKeyRing returns a key ring with the secrets.  Every secret must be at least 32 bytes long.
+func NewKeyRing(secrets ...[]byte) (*KeyRing, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("napnap: at least one secret is required")
+	}
+
+	ring := &KeyRing{}
+	for _, secret := range secrets {
+		if len(secret) < minCookieSecretSize {
+			return nil, errors.New("napnap: secret must be at least " + strconv.Itoa(minCookieSecretSize) + " bytes long")
+		}
+		// derive different keys for signing and encryption from the secret
+		block, err := aes.NewCipher(deriveKey(secret, "napnap cookie encryption"))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys = append(ring.keys, cookieKey{
+			signKey: deriveKey(secret, "napnap cookie signing"),
+			aead:    aead,
+		})
+	}
+	return ring, nil
+}
+
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// SetCookieWithOptions allows us to create an cookie with all attributes.  The value is url encoded.
+func (c *Context) SetCookieWithOptions(name, value string, opts *CookieOptions) {
+	c.setCookie(name, url.QueryEscape(value), opts)
+}
+
+// DeleteCookie asks the client to delete the cookie.  The path and domain must be the same as the cookie was set.
+func (c *Context) DeleteCookie(name string, opts *CookieOptions) {
+	deleted := CookieOptions{}
+	if opts != nil {
+		deleted = *opts
+	}
+	deleted.MaxAge = -1
+	deleted.Expires = time.Unix(0, 0)
+	c.setCookie(name, "", &deleted)
+}
+
+func (c *Context) setCookie(name, value string, opts *CookieOptions) {
+	if opts == nil {
+		opts = &CookieOptions{}
+	}
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:        name,
+		Value:       value,
+		Path:        path,
+		Domain:      opts.Domain,
+		MaxAge:      opts.MaxAge,
+		Expires:     opts.Expires,
+		Secure:      opts.Secure || opts.Partitioned,
+		HttpOnly:    opts.HttpOnly,
+		SameSite:    opts.SameSite,
+		Partitioned: opts.Partitioned,
+	})
+}
+
+// SetSignedCookie creates a cookie which is signed with HMAC-SHA256, so the client can read but can't change the value.
+// The expiration of the options is signed as well, so the cookie can't be used after it expired.
+func (c *Context) SetSignedCookie(name, value string, opts *CookieOptions) error {
+	ring := c.NapNap.CookieKeys
+	if ring == nil {
+		return ErrKeyRingRequired
+	}
+	if opts == nil {
+		opts = &CookieOptions{}
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + strconv.FormatInt(unixOrZero(opts.expiration()), 10)
+	signature := signCookie(ring.keys[0].signKey, name, payload)
+	c.setCookie(name, payload+"."+signature, opts)
+	return nil
+}
+
+// SignedCookie returns the value of the signed cookie.  ErrInvalidCookie is returned if the cookie was tampered or expired.
+func (c *Context) SignedCookie(name string) (string, error) {
+	ring := c.NapNap.CookieKeys
+	if ring == nil {
+		return "", ErrKeyRingRequired
+	}
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	index := strings.LastIndexByte(cookie.Value, '.')
+	if index < 0 {
+		return "", ErrInvalidCookie
+	}
+	payload, signature := cookie.Value[:index], cookie.Value[index+1:]
+
+	verified := false
+	for _, key := range ring.keys {
+		if hmac.Equal([]byte(signature), []byte(signCookie(key.signKey, name, payload))) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return "", ErrInvalidCookie
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidCookie
+	}
+	expiration, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || isExpired(expiration) {
+		return "", ErrInvalidCookie
+	}
+	value, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	return string(value), nil
+}
+
+// SetEncryptedCookie creates a cookie which is encrypted with AES-GCM, so the client can neither read nor change the value.
+// The expiration of the options is encrypted as well, so the cookie can't be used after it expired.
+func (c *Context) SetEncryptedCookie(name, value string, opts *CookieOptions) error {
+	ring := c.NapNap.CookieKeys
+	if ring == nil {
+		return ErrKeyRingRequired
+	}
+	if opts == nil {
+		opts = &CookieOptions{}
+	}
+
+	aead := ring.keys[0].aead
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+8+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	plaintext := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(plaintext, uint64(unixOrZero(opts.expiration())))
+	plaintext = append(plaintext, value...)
+
+	// the cookie name is authenticated, so the value can't be moved to another cookie
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(name))
+	c.setCookie(name, base64.RawURLEncoding.EncodeToString(sealed), opts)
+	return nil
+}
+
+// EncryptedCookie returns the decrypted value of the encrypted cookie.  ErrInvalidCookie is returned if the cookie
+// was tampered, expired or can't be decrypted by any key.
+func (c *Context) EncryptedCookie(name string) (string, error) {
+	ring := c.NapNap.CookieKeys
+	if ring == nil {
+		return "", ErrKeyRingRequired
+	}
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	for _, key := range ring.keys {
+		nonceSize := key.aead.NonceSize()
+		if len(sealed) < nonceSize {
+			return "", ErrInvalidCookie
+		}
+		plaintext, err := key.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+		if err != nil {
+			continue
+		}
+		if len(plaintext) < 8 || isExpired(int64(binary.BigEndian.Uint64(plaintext[:8]))) {
+			return "", ErrInvalidCookie
+		}
+		return string(plaintext[8:]), nil
+	}
+	return "", ErrInvalidCookie
+}
+
+func signCookie(key []byte, name, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(name + "=" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func isExpired(expiration int64) bool {
+	return expiration != 0 && time.Now().Unix() > expiration
+}
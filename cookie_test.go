@@ -0,0 +1,128 @@
+package napnap
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testSecret1 = bytes.Repeat([]byte("1"), 32)
+	testSecret2 = bytes.Repeat([]byte("2"), 32)
+)
+
+// roundTripCookie returns a request context which carries the cookies of the response
+func roundTripCookie(nap *NapNap, w *httptest.ResponseRecorder) *Context {
+	c, _, _ := createTestContext()
+	c.NapNap = nap
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		c.Request.AddCookie(cookie)
+	}
+	return c
+}
+
+func TestContextSetCookieWithOptions(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	c.SetCookieWithOptions("user", "jason lee", &CookieOptions{
+		MaxAge:      60,
+		SameSite:    http.SameSiteStrictMode,
+		HttpOnly:    true,
+		Partitioned: true,
+	})
+	assert.Equal(t, "user=jason+lee; Path=/; Max-Age=60; HttpOnly; Secure; SameSite=Strict; Partitioned", w.Header().Get("Set-Cookie"))
+
+	c, w, _ = createTestContext()
+	c.DeleteCookie("user", &CookieOptions{Path: "/admin"})
+	assert.Equal(t, "user=; Path=/admin; Expires=Thu, 01 Jan 1970 00:00:00 GMT; Max-Age=0", w.Header().Get("Set-Cookie"))
+}
+
+func TestKeyRing(t *testing.T) {
+	_, err := NewKeyRing()
+	assert.Error(t, err)
+	_, err = NewKeyRing([]byte("short"))
+	assert.Error(t, err)
+	_, err = NewKeyRing(testSecret1, testSecret2)
+	assert.Nil(t, err)
+}
+
+func TestContextSignedCookie(t *testing.T) {
+	c, w, nap := createTestContext()
+	assert.Equal(t, ErrKeyRingRequired, c.SetSignedCookie("user", "jason", nil))
+
+	nap.CookieKeys, _ = NewKeyRing(testSecret1)
+	assert.Nil(t, c.SetSignedCookie("user", "jason", &CookieOptions{MaxAge: 60}))
+
+	c = roundTripCookie(nap, w)
+	val, err := c.SignedCookie("user")
+	assert.Nil(t, err)
+	assert.Equal(t, "jason", val)
+
+	// the cookie was signed with the old key which is still in the ring
+	nap.CookieKeys, _ = NewKeyRing(testSecret2, testSecret1)
+	val, err = c.SignedCookie("user")
+	assert.Nil(t, err)
+	assert.Equal(t, "jason", val)
+
+	// the old key was removed
+	nap.CookieKeys, _ = NewKeyRing(testSecret2)
+	_, err = c.SignedCookie("user")
+	assert.Equal(t, ErrInvalidCookie, err)
+
+	// tampered value
+	nap.CookieKeys, _ = NewKeyRing(testSecret1)
+	cookie, _ := c.Request.Cookie("user")
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.AddCookie(&http.Cookie{Name: "user", Value: "YWRtaW4" + cookie.Value[5:]})
+	_, err = c.SignedCookie("user")
+	assert.Equal(t, ErrInvalidCookie, err)
+
+	// the value can't be moved to another cookie
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.AddCookie(&http.Cookie{Name: "admin", Value: cookie.Value})
+	_, err = c.SignedCookie("admin")
+	assert.Equal(t, ErrInvalidCookie, err)
+}
+
+func TestContextSignedCookieExpired(t *testing.T) {
+	c, w, nap := createTestContext()
+	nap.CookieKeys, _ = NewKeyRing(testSecret1)
+	assert.Nil(t, c.SetSignedCookie("user", "jason", &CookieOptions{Expires: time.Now().Add(-time.Minute)}))
+
+	c = roundTripCookie(nap, w)
+	_, err := c.SignedCookie("user")
+	assert.Equal(t, ErrInvalidCookie, err)
+}
+
+func TestContextEncryptedCookie(t *testing.T) {
+	c, w, nap := createTestContext()
+	nap.CookieKeys, _ = NewKeyRing(testSecret1)
+	assert.Nil(t, c.SetEncryptedCookie("session", `{"user_id":1}`, &CookieOptions{HttpOnly: true, MaxAge: 60}))
+	assert.NotContains(t, w.Header().Get("Set-Cookie"), "user_id")
+
+	c = roundTripCookie(nap, w)
+	val, err := c.EncryptedCookie("session")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"user_id":1}`, val)
+
+	nap.CookieKeys, _ = NewKeyRing(testSecret2, testSecret1)
+	val, err = c.EncryptedCookie("session")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"user_id":1}`, val)
+
+	nap.CookieKeys, _ = NewKeyRing(testSecret2)
+	_, err = c.EncryptedCookie("session")
+	assert.Equal(t, ErrInvalidCookie, err)
+
+	nap.CookieKeys, _ = NewKeyRing(testSecret1)
+	cookie, _ := c.Request.Cookie("session")
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.AddCookie(&http.Cookie{Name: "other", Value: cookie.Value})
+	_, err = c.EncryptedCookie("other")
+	assert.Equal(t, ErrInvalidCookie, err)
+}
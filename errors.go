@@ -0,0 +1,129 @@
+package napnap
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTPError is an error which carries the HTTP status code of the response.
+type HTTPError struct {
+	Code    int
+	Message string
+	// Err is the cause of the error.  It isn't sent to the client.
+	Err error
+}
+
+// NewHTTPError returns a HTTPError.  If the message is empty, the status text of the code is used.
+func NewHTTPError(code int, message string) *HTTPError {
+	if len(message) == 0 {
+		message = http.StatusText(code)
+	}
+	return &HTTPError{Code: code, Message: message}
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the cause of the error.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code of the error.
+func (e *HTTPError) StatusCode() int {
+	return e.Code
+}
+
+// ErrNotFound can be returned by NotFoundHandler, so unmatched routes are answered by ErrorHandler with 404.
+var ErrNotFound = NewHTTPError(http.StatusNotFound, "")
+
+// ErrorPage is the data of the responses of DefaultErrorHandler.  It is written as JSON or passed to the error views.
+type ErrorPage struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// DefaultErrorHandler writes the error with the status code of the error and the request id.  It is enabled by
+// setting NapNap.ErrorHandler to DefaultErrorHandler.  When the client accepts HTML,
+// the view "errors/<code>.html" or "errors/error.html" is rendered if it exists, so error pages can use the layouts.
+// Otherwise the error is written as JSON.
+// Only the message of the error which carries the status code is sent, not the context which was added by wrapping it.
+// Errors without a status code become 500 and their messages aren't sent to the client.  Nothing is written if the response was already sent.
+func DefaultErrorHandler(c *Context, err error) {
+	code, _ := errorStatusCode(err)
+	message := errorMessage(err, code)
+	if code >= http.StatusInternalServerError {
+		c.Logger().Error("napnap: request failed", "status", code, "error", err)
+	}
+	if c.Writer.Written() {
+		// the response can't be changed anymore
+		return
+	}
+	page := ErrorPage{
+		Code:      code,
+		Message:   message,
+		RequestID: c.RequestID(),
+	}
+	if c.acceptsHTML() && c.renderErrorPage(page) {
+		return
+	}
+	_ = c.JSON(code, page)
+}
+
+// statusError is an error which carries the status code of the response, such as HTTPError.
+type statusError interface {
+	error
+	StatusCode() int
+}
+
+// errorStatusCode returns the status code of the error.  Errors without a status code are 500 and ok is false.
+func errorStatusCode(err error) (code int, ok bool) {
+	var se statusError
+	if errors.As(err, &se) {
+		return se.StatusCode(), true
+	}
+	return http.StatusInternalServerError, false
+}
+
+// errorMessage returns the message of the error in the chain which carries the status code.
+// The status text is used for the other errors and for empty messages.
+func errorMessage(err error, code int) string {
+	var se statusError
+	if errors.As(err, &se) {
+		if message := se.Error(); len(message) > 0 {
+			return message
+		}
+	}
+	return http.StatusText(code)
+}
+
+// renderErrorPage renders the error view of the status code.  It returns false when no error view exists.
+func (c *Context) renderErrorPage(page ErrorPage) bool {
+	if c.NapNap.renderer == nil && len(c.NapNap.renderers) == 0 {
+		return false
+	}
+	for _, view := range []string{"errors/" + strconv.Itoa(page.Code) + ".html", "errors/error.html"} {
+		b, err := c.NapNap.RenderToBytes(view, page)
+		if err != nil {
+			if !isViewNotFound(err) {
+				c.Logger().Error("napnap: error view failed", "view", view, "error", err)
+				return false
+			}
+			continue
+		}
+		c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		c.Writer.WriteHeader(page.Code)
+		_, _ = c.Writer.Write(b)
+		return true
+	}
+	return false
+}
+
+// acceptsHTML returns true when the client prefers HTML, such as browsers.
+func (c *Context) acceptsHTML() bool {
+	return strings.Contains(c.RequestHeader("Accept"), "text/html")
+}
@@ -0,0 +1,62 @@
+package napnap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultErrorHandler(t *testing.T) {
+	nap := New()
+	nap.ErrorHandler = DefaultErrorHandler
+	nap.Get("/conflict", func(c *Context) error {
+		c.SetRequestID("abc-123")
+		return fmt.Errorf("save order: %w", NewHTTPError(http.StatusConflict, "order exists"))
+	})
+	nap.Get("/internal", func(c *Context) error {
+		return errors.New("connection refused")
+	})
+
+	req, _ := http.NewRequest("GET", "/conflict", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	// the context which was added by wrapping the error isn't sent to the client
+	assert.Equal(t, `{"code":409,"message":"order exists","request_id":"abc-123"}`, w.Body.String())
+
+	// the message of internal errors isn't sent to the client
+	req, _ = http.NewRequest("GET", "/internal", nil)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, `{"code":500,"message":"Internal Server Error"}`, w.Body.String())
+}
+
+func TestNilErrorHandler(t *testing.T) {
+	nap := New()
+	assert.Nil(t, nap.ErrorHandler)
+	nap.Get("/plain", func(c *Context) error {
+		return errors.New("connection refused")
+	})
+	nap.Get("/conflict", func(c *Context) error {
+		return NewHTTPError(http.StatusConflict, "order exists")
+	})
+
+	// errors are only logged and no body is written
+	req, _ := http.NewRequest("GET", "/plain", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// the status of errors which carry one is still sent
+	req, _ = http.NewRequest("GET", "/conflict", nil)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, w.Body.String())
+}
@@ -0,0 +1,52 @@
+package napnap
+
+// Key is a typed key of the context store.  Keys are compared by identity, so keys with the same name
+// which are created by different packages never collide.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new key for values of type T.  The name is only used for debugging.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// String returns the name of the key.
+func (k *Key[T]) String() string {
+	return "napnap.Key(" + k.name + ")"
+}
+
+func (k *Key[T]) napnapKey() {}
+
+// typedKey is implemented by all keys of type Key, so the standard context only exposes them.
+type typedKey interface {
+	napnapKey()
+}
+
+// Value retrieves the value of the key from the context store.
+func Value[T any](c *Context, key *Key[T]) (T, bool) {
+	c.mustBeActive()
+	val, exists := c.store[key]
+	if !exists {
+		var zero T
+		return zero, false
+	}
+	return val.(T), true
+}
+
+// MustValue returns the value of the key if it exists, otherwise it panics.
+func MustValue[T any](c *Context, key *Key[T]) T {
+	if val, exists := Value(c, key); exists {
+		return val
+	}
+	panic(key.String() + " does not exist")
+}
+
+// SetValue saves the value of the key in the context store.  The value can also be read from StdContext().Value(key).
+func SetValue[T any](c *Context, key *Key[T], val T) {
+	c.mustBeActive()
+	if c.store == nil {
+		c.store = make(map[interface{}]interface{})
+	}
+	c.store[key] = val
+}
@@ -0,0 +1,61 @@
+package napnap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testUser struct {
+	Name string
+}
+
+func TestContextTypedValue(t *testing.T) {
+	userKey := NewKey[*testUser]("user")
+	otherUserKey := NewKey[string]("user")
+
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+
+	_, exists := Value(c, userKey)
+	assert.False(t, exists)
+	assert.PanicsWithValue(t, "napnap.Key(user) does not exist", func() { MustValue(c, userKey) })
+
+	SetValue(c, userKey, &testUser{Name: "jason"})
+	SetValue(c, otherUserKey, "angela")
+	c.Set("user", 1)
+
+	user, exists := Value(c, userKey)
+	assert.True(t, exists)
+	assert.Equal(t, "jason", user.Name)
+	assert.Equal(t, "angela", MustValue(c, otherUserKey))
+	assert.Equal(t, 1, c.MustGet("user"))
+
+	// libraries which only accept the standard context see the same values
+	ctx := c.StdContext()
+	assert.Equal(t, "jason", ctx.Value(userKey).(*testUser).Name)
+	assert.Equal(t, "angela", ctx.Value(otherUserKey))
+	napCtx, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, c, napCtx)
+}
+
+func TestStdContextValues(t *testing.T) {
+	userKey := NewKey[string]("user")
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	SetValue(c, userKey, "jason")
+	c.Set("user", "string key")
+
+	// string keys of Set aren't exposed
+	ctx := c.StdContext()
+	assert.Nil(t, ctx.Value("user"))
+	assert.Equal(t, "jason", ctx.Value(userKey))
+
+	// the values were copied, so a later request which reuses the context isn't visible
+	c.reset(httptest.NewRecorder(), c.Request)
+	SetValue(c, userKey, "angela")
+	assert.Equal(t, "jason", ctx.Value(userKey))
+}
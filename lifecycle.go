@@ -0,0 +1,115 @@
+package napnap
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// State is the lifecycle state of a NapNap instance.
+type State int32
+
+const (
+	// StateStarting means the OnStart functions are running or no server was started yet.
+	StateStarting State = iota
+	// StateReady means a server is accepting connections.
+	StateReady
+	// StateDraining means Shutdown was called and the active requests are finishing.
+	StateDraining
+	// StateStopped means all servers were drained.
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateReady:
+		return "ready"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// State returns the lifecycle state, so readiness checks can stop accepting traffic before the servers are drained.
+func (nap *NapNap) State() State {
+	return State(nap.state.Load())
+}
+
+// OnStart registers a function which is called once before the first server starts listening, such as to run migrations.
+// The Run methods return the error without listening when a function fails.
+func (nap *NapNap) OnStart(fn func(ctx context.Context) error) {
+	nap.lifecycleMu.Lock()
+	defer nap.lifecycleMu.Unlock()
+	nap.startHooks = append(nap.startHooks, fn)
+}
+
+// OnListening registers a function which is called with the bound address when a server starts listening.
+// It is useful when the server listens on ":0" and the port is chosen by the system.
+func (nap *NapNap) OnListening(fn func(addr net.Addr)) {
+	nap.lifecycleMu.Lock()
+	defer nap.lifecycleMu.Unlock()
+	nap.listeningHooks = append(nap.listeningHooks, fn)
+}
+
+// OnStopped registers a function which is called after Shutdown drained the servers.
+func (nap *NapNap) OnStopped(fn func()) {
+	nap.lifecycleMu.Lock()
+	defer nap.lifecycleMu.Unlock()
+	nap.stoppedHooks = append(nap.stoppedHooks, fn)
+}
+
+// Addrs returns the addresses of the servers which are listening.
+func (nap *NapNap) Addrs() []net.Addr {
+	nap.lifecycleMu.Lock()
+	defer nap.lifecycleMu.Unlock()
+	addrs := make([]net.Addr, 0, len(nap.servers))
+	for _, ts := range nap.servers {
+		if ts.addr != nil {
+			addrs = append(addrs, ts.addr)
+		}
+	}
+	return addrs
+}
+
+// start calls the OnStart functions once.  Servers which are started at the same time wait for the same result.
+func (nap *NapNap) start() error {
+	nap.startOnce.Do(func() {
+		nap.lifecycleMu.Lock()
+		hooks := append([]func(ctx context.Context) error(nil), nap.startHooks...)
+		nap.lifecycleMu.Unlock()
+
+		for _, hook := range hooks {
+			if err := hook(context.Background()); err != nil {
+				nap.startErr = err
+				return
+			}
+		}
+	})
+	return nap.startErr
+}
+
+// listening records the bound address of the server, calls the OnListening functions and marks the instance ready.
+func (nap *NapNap) listening(srv *http.Server, addr net.Addr) {
+	nap.lifecycleMu.Lock()
+	if ts, ok := nap.servers[srv]; ok {
+		ts.addr = addr
+	}
+	hooks := append(([]func(addr net.Addr))(nil), nap.listeningHooks...)
+	nap.lifecycleMu.Unlock()
+
+	nap.state.CompareAndSwap(int32(StateStarting), int32(StateReady))
+	for _, hook := range hooks {
+		hook(addr)
+	}
+}
+
+// trackedServer is a server which was started by the Run methods.
+type trackedServer struct {
+	// engine is nil for the servers which napnap creates itself, such as by RunAll.
+	engine *Server
+	addr   net.Addr
+}
@@ -0,0 +1,141 @@
+package napnap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	nap := New()
+	nap.ShutdownSignals = nil
+	nap.Get("/", func(c *Context) error {
+		return c.String(200, c.NapNap.State().String())
+	})
+
+	var events []string
+	nap.OnStart(func(ctx context.Context) error {
+		events = append(events, "start")
+		return nil
+	})
+	listening := make(chan net.Addr, 1)
+	nap.OnListening(func(addr net.Addr) {
+		events = append(events, "listening")
+		listening <- addr
+	})
+	nap.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "shutdown:"+nap.State().String())
+		return nil
+	})
+	nap.OnStopped(func() {
+		events = append(events, "stopped")
+	})
+	assert.Equal(t, StateStarting, nap.State())
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- nap.Run(NewHTTPEngine("127.0.0.1:0"))
+	}()
+	addr := <-listening
+	assert.NotEqual(t, 0, addr.(*net.TCPAddr).Port)
+	assert.Equal(t, []net.Addr{addr}, nap.Addrs())
+
+	resp, err := http.Get("http://" + addr.String() + "/")
+	assert.NoError(t, err)
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "ready", string(b))
+
+	assert.NoError(t, nap.Shutdown(context.Background()))
+	assert.NoError(t, <-runErr)
+	assert.Equal(t, StateStopped, nap.State())
+	assert.Equal(t, []string{"start", "listening", "shutdown:draining", "stopped"}, events)
+	assert.Empty(t, nap.Addrs())
+}
+
+func TestOnStartError(t *testing.T) {
+	nap := New()
+	nap.ShutdownSignals = nil
+	errMigration := errors.New("migration failed")
+	nap.OnStart(func(ctx context.Context) error {
+		return errMigration
+	})
+	var listened bool
+	nap.OnListening(func(addr net.Addr) {
+		listened = true
+	})
+
+	assert.Equal(t, errMigration, nap.Run(NewHTTPEngine("127.0.0.1:0")))
+	assert.False(t, listened)
+	assert.Equal(t, StateStarting, nap.State())
+}
+
+func TestServerLifecycle(t *testing.T) {
+	nap := New()
+	nap.ShutdownSignals = nil
+
+	var events []string
+	nap.OnStart(func(ctx context.Context) error {
+		events = append(events, "nap:start")
+		return nil
+	})
+	nap.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "nap:shutdown")
+		return nil
+	})
+	nap.OnStopped(func() {
+		events = append(events, "nap:stopped")
+	})
+
+	engine := NewHTTPEngine("127.0.0.1:0")
+	engine.OnStart(func(ctx context.Context) error {
+		events = append(events, "server:start")
+		return nil
+	})
+	listening := make(chan net.Addr, 1)
+	engine.OnListening(func(addr net.Addr) {
+		events = append(events, "server:listening")
+		listening <- addr
+	})
+	engine.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "server:shutdown:"+nap.State().String())
+		return nil
+	})
+	engine.OnStopped(func() {
+		events = append(events, "server:stopped")
+	})
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- nap.Run(engine)
+	}()
+	addr := <-listening
+	assert.Equal(t, []net.Addr{addr}, nap.Addrs())
+
+	assert.NoError(t, nap.Shutdown(context.Background()))
+	assert.NoError(t, <-runErr)
+	assert.Equal(t, []string{
+		"nap:start", "server:start", "server:listening",
+		"nap:shutdown", "server:shutdown:draining",
+		"nap:stopped", "server:stopped",
+	}, events)
+}
+
+func TestServerOnStartError(t *testing.T) {
+	nap := New()
+	nap.ShutdownSignals = nil
+	errMigration := errors.New("migration failed")
+	engine := NewHTTPEngine("127.0.0.1:0")
+	engine.OnStart(func(ctx context.Context) error {
+		return errMigration
+	})
+
+	assert.Equal(t, errMigration, nap.Run(engine))
+	assert.Equal(t, StateStarting, nap.State())
+	assert.Empty(t, nap.Addrs())
+}
@@ -0,0 +1,78 @@
+package napnap
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// Logger is the structured logger of napnap.  The arguments are alternating keys and values like log/slog.
+type Logger interface {
+	// Enabled returns true when the messages of the level are logged, so expensive arguments can be skipped.
+	Enabled(level slog.Level) bool
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+	// With returns a logger which includes the arguments in every message.
+	With(args ...interface{}) Logger
+}
+
+// slogLogger adapts a slog.Logger to Logger.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger returns a Logger which writes through the slog logger.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (s slogLogger) Enabled(level slog.Level) bool {
+	return s.l.Enabled(context.Background(), level)
+}
+
+func (s slogLogger) Debug(msg string, args ...interface{}) {
+	s.l.Debug(msg, args...)
+}
+
+func (s slogLogger) Info(msg string, args ...interface{}) {
+	s.l.Info(msg, args...)
+}
+
+func (s slogLogger) Warn(msg string, args ...interface{}) {
+	s.l.Warn(msg, args...)
+}
+
+func (s slogLogger) Error(msg string, args ...interface{}) {
+	s.l.Error(msg, args...)
+}
+
+func (s slogLogger) With(args ...interface{}) Logger {
+	return slogLogger{l: s.l.With(args...)}
+}
+
+// newDefaultLogger returns a text logger which writes to stderr with the level of the level var.
+func newDefaultLogger(level *slog.LevelVar) Logger {
+	return NewSlogLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// debugEnabled returns true when the debug traces should be logged.
+func (nap *NapNap) debugEnabled() bool {
+	return nap.Logger.Enabled(slog.LevelDebug)
+}
+
+// Logger returns the logger of the request which includes the request id, the method and the path.
+func (c *Context) Logger() Logger {
+	if c.logger == nil {
+		args := make([]interface{}, 0, 6)
+		if len(c.requestID) > 0 {
+			args = append(args, "request_id", c.requestID)
+		}
+		if c.Request != nil {
+			args = append(args, "method", c.Request.Method, "path", c.Request.URL.Path)
+		}
+		c.logger = c.NapNap.Logger.With(args...)
+	}
+	return c.logger
+}
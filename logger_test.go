@@ -0,0 +1,50 @@
+package napnap
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	nap := New()
+	nap.Logger = NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})))
+	nap.Get("/users/:id", func(c *Context) error {
+		c.SetRequestID("req-1")
+		c.Logger().Info("loaded user", "id", c.Param("id"))
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "/users/42", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "loaded user", entry["msg"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/users/42", entry["path"])
+	assert.Equal(t, "42", entry["id"])
+
+	// router traces are only logged at debug level
+	assert.NotContains(t, buf.String(), "router: find")
+	level.Set(slog.LevelDebug)
+	buf.Reset()
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, strings.Contains(buf.String(), `"msg":"router: find"`))
+}
+
+func TestDefaultLoggerLevel(t *testing.T) {
+	nap := New()
+	assert.False(t, nap.Logger.Enabled(slog.LevelDebug))
+	nap.LogLevel.Set(slog.LevelDebug)
+	assert.True(t, nap.Logger.Enabled(slog.LevelDebug))
+}
@@ -0,0 +1,326 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/jasonsoft/napnap"
+)
+
+const (
+	// AccessLogCommon is the Apache common log format.
+	AccessLogCommon = "common"
+	// AccessLogCombined is the Apache combined log format which adds the referer and the user agent to the common format.
+	AccessLogCombined = "combined"
+	// AccessLogJSON writes a json object per line.
+	AccessLogJSON = "json"
+)
+
+// AccessLogRecord is the information of a request which is written to the access log.
+// Custom formats are text/template templates which are executed with the record, such as `{{.Method}} {{.Path}} {{.Status}}`.
+// The values of the request are escaped like the built-in formats, so clients can't forge log lines.
+type AccessLogRecord struct {
+	Time         time.Time     `json:"time"`
+	Method       string        `json:"method"`
+	Path         string        `json:"path"`
+	Query        string        `json:"query,omitempty"`
+	Proto        string        `json:"proto"`
+	RoutePattern string        `json:"route,omitempty"`
+	Status       int           `json:"status"`
+	Bytes        int64         `json:"bytes"`
+	Latency      time.Duration `json:"latency_ns"`
+	ClientIP     string        `json:"client_ip"`
+	UserAgent    string        `json:"user_agent,omitempty"`
+	Referer      string        `json:"referer,omitempty"`
+	RequestID    string        `json:"request_id,omitempty"`
+}
+
+// AccessLog is a middleware handler that writes a line for every request.  Lines are queued and written by a goroutine,
+// so slow outputs never block handlers; lines are dropped when the queue is full.  Call Close to flush the queue on shutdown.
+type AccessLog struct {
+	// Format is AccessLogCommon, AccessLogCombined, AccessLogJSON or a custom template.  Default value is AccessLogCombined
+	Format string
+	// Output is where the lines are written.  Default value is os.Stdout
+	Output io.Writer
+	// SkipPaths are the paths which aren't logged, such as "/health".  A path which ends with "*" matches the prefix.
+	SkipPaths []string
+	// MinStatus is the lowest status which is logged, such as 400 to log errors only.  Default value is 0 which logs all.
+	MinStatus int
+	// SampleRate is the fraction of the requests which are logged, between 0 and 1.  Server errors are always logged.
+	// Default value is 1
+	SampleRate float64
+	// QueueSize is the number of lines which can wait to be written.  Default value is 1024
+	QueueSize int
+
+	once     sync.Once
+	tmpl     *template.Template
+	queue    chan []byte
+	done     chan struct{}
+	closed   atomic.Bool
+	dropped  atomic.Int64
+	closeMu  sync.RWMutex
+	bufPool  sync.Pool
+	flushDur time.Duration
+}
+
+// NewAccessLog returns a new instance of AccessLog which writes the combined format to os.Stdout
+func NewAccessLog() *AccessLog {
+	return &AccessLog{
+		Format:     AccessLogCombined,
+		Output:     os.Stdout,
+		SampleRate: 1,
+		QueueSize:  1024,
+	}
+}
+
+// init parses the format and starts the writer.  An invalid custom template panics at the first request.
+func (l *AccessLog) init() {
+	l.once.Do(func() {
+		if len(l.Format) == 0 {
+			l.Format = AccessLogCombined
+		}
+		if l.Output == nil {
+			l.Output = os.Stdout
+		}
+		if l.QueueSize <= 0 {
+			l.QueueSize = 1024
+		}
+		switch l.Format {
+		case AccessLogCommon, AccessLogCombined, AccessLogJSON:
+		default:
+			l.tmpl = template.Must(template.New("accesslog").Parse(l.Format))
+		}
+		l.flushDur = time.Second
+		l.bufPool.New = func() interface{} { return new(bytes.Buffer) }
+		l.queue = make(chan []byte, l.QueueSize)
+		l.done = make(chan struct{})
+		go l.run()
+	})
+}
+
+// Invoke function is a middleware entry
+func (l *AccessLog) Invoke(c *napnap.Context, next napnap.HandlerFunc) {
+	l.init()
+	start := time.Now()
+	req := c.Request
+	_ = next(c)
+
+	status := c.Writer.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if !l.shouldLog(req.URL.Path, status) {
+		return
+	}
+
+	record := AccessLogRecord{
+		Time:         start,
+		Method:       req.Method,
+		Path:         req.URL.Path,
+		Query:        req.URL.RawQuery,
+		Proto:        req.Proto,
+		RoutePattern: c.RoutePattern(),
+		Status:       status,
+		Bytes:        c.Writer.BytesWritten(),
+		Latency:      time.Since(start),
+		ClientIP:     c.ClientIP(),
+		UserAgent:    req.UserAgent(),
+		Referer:      req.Referer(),
+		RequestID:    c.RequestID(),
+	}
+	l.write(&record)
+}
+
+// Dropped returns the number of lines which were dropped because the queue was full.
+func (l *AccessLog) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Close writes the queued lines and stops the writer.  Lines of later requests are dropped.
+func (l *AccessLog) Close() error {
+	l.init()
+	l.closeMu.Lock()
+	if l.closed.Swap(true) {
+		l.closeMu.Unlock()
+		return nil
+	}
+	close(l.queue)
+	l.closeMu.Unlock()
+	<-l.done
+	return nil
+}
+
+func (l *AccessLog) shouldLog(path string, status int) bool {
+	for _, skip := range l.SkipPaths {
+		if strings.HasSuffix(skip, "*") {
+			if strings.HasPrefix(path, skip[:len(skip)-1]) {
+				return false
+			}
+		} else if path == skip {
+			return false
+		}
+	}
+	if status < l.MinStatus {
+		return false
+	}
+	if status >= http.StatusInternalServerError || l.SampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < l.SampleRate
+}
+
+func (l *AccessLog) write(record *AccessLogRecord) {
+	buf := l.bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer l.bufPool.Put(buf)
+
+	switch {
+	case l.tmpl != nil:
+		if err := l.tmpl.Execute(buf, escapeLogRecord(record)); err != nil {
+			return
+		}
+	case l.Format == AccessLogJSON:
+		if err := json.NewEncoder(buf).Encode(record); err != nil {
+			return
+		}
+	default:
+		formatCommon(buf, record, l.Format == AccessLogCombined)
+	}
+	if b := buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	line := append([]byte(nil), buf.Bytes()...)
+	l.closeMu.RLock()
+	defer l.closeMu.RUnlock()
+	if l.closed.Load() {
+		l.dropped.Add(1)
+		return
+	}
+	select {
+	case l.queue <- line:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// run writes the queued lines and flushes them when the queue is empty or every second.
+func (l *AccessLog) run() {
+	defer close(l.done)
+	w := bufio.NewWriter(l.Output)
+	ticker := time.NewTicker(l.flushDur)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-l.queue:
+			if !ok {
+				_ = w.Flush()
+				return
+			}
+			_, _ = w.Write(line)
+			if len(l.queue) == 0 {
+				_ = w.Flush()
+			}
+		case <-ticker.C:
+			_ = w.Flush()
+		}
+	}
+}
+
+// formatCommon writes the Apache common or combined format.
+func formatCommon(buf *bytes.Buffer, r *AccessLogRecord, combined bool) {
+	buf.WriteString(dashIfEmpty(r.ClientIP))
+	buf.WriteString(" - - [")
+	buf.WriteString(r.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	buf.WriteString("] \"")
+	buf.WriteString(r.Method)
+	buf.WriteByte(' ')
+	buf.WriteString(escapeLogValue(requestURI(r)))
+	buf.WriteByte(' ')
+	buf.WriteString(r.Proto)
+	buf.WriteString("\" ")
+	buf.WriteString(strconv.Itoa(r.Status))
+	buf.WriteByte(' ')
+	if r.Bytes == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteString(strconv.FormatInt(r.Bytes, 10))
+	}
+	if combined {
+		buf.WriteString(" \"")
+		buf.WriteString(escapeLogValue(dashIfEmpty(r.Referer)))
+		buf.WriteString("\" \"")
+		buf.WriteString(escapeLogValue(dashIfEmpty(r.UserAgent)))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('\n')
+}
+
+// escapeLogRecord returns a copy of the record whose values from the request are escaped for custom templates.
+func escapeLogRecord(r *AccessLogRecord) *AccessLogRecord {
+	escaped := *r
+	escaped.Method = escapeLogValue(r.Method)
+	escaped.Path = escapeLogValue(r.Path)
+	escaped.Query = escapeLogValue(r.Query)
+	escaped.Proto = escapeLogValue(r.Proto)
+	escaped.RoutePattern = escapeLogValue(r.RoutePattern)
+	escaped.ClientIP = escapeLogValue(r.ClientIP)
+	escaped.UserAgent = escapeLogValue(r.UserAgent)
+	escaped.Referer = escapeLogValue(r.Referer)
+	escaped.RequestID = escapeLogValue(r.RequestID)
+	return &escaped
+}
+
+func requestURI(r *AccessLogRecord) string {
+	if len(r.Query) == 0 {
+		return r.Path
+	}
+	return r.Path + "?" + r.Query
+}
+
+func dashIfEmpty(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+// escapeLogValue escapes quotes, backslashes and control characters, so clients can't forge log lines.
+func escapeLogValue(s string) string {
+	needsEscape := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' || s[i] < 0x20 || s[i] == 0x7f {
+			needsEscape = true
+			break
+		}
+	}
+	if !needsEscape {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '"' || ch == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(ch)
+		case ch < 0x20 || ch == 0x7f:
+			sb.WriteString(`\x`)
+			sb.WriteString(strconv.FormatInt(int64(ch)>>4, 16))
+			sb.WriteString(strconv.FormatInt(int64(ch)&0xf, 16))
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jasonsoft/napnap"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAccessLogTestApp(l *AccessLog) *napnap.NapNap {
+	nap := napnap.New()
+	nap.ErrorHandler = napnap.DefaultErrorHandler
+	nap.NotFoundHandler = func(c *napnap.Context) error {
+		return napnap.ErrNotFound
+	}
+	nap.Use(l)
+	nap.Get("/users/:id", func(c *napnap.Context) error {
+		return c.String(http.StatusCreated, "hello")
+	})
+	nap.Get("/fail", func(c *napnap.Context) error {
+		return errors.New("boom")
+	})
+	return nap
+}
+
+func accessLogRequest(nap *napnap.NapNap, path string, headers map[string]string) {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAccessLogCommonAndCombined(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewAccessLog()
+	l.Format = AccessLogCommon
+	l.Output = &buf
+	nap := newAccessLogTestApp(l)
+	accessLogRequest(nap, "/users/5?x=1", nil)
+	assert.NoError(t, l.Close())
+	assert.Regexp(t, regexp.MustCompile(`^1\.2\.3\.4 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /users/5\?x=1 HTTP/1\.1" 201 5\n$`), buf.String())
+
+	buf.Reset()
+	l = NewAccessLog()
+	l.Output = &buf
+	nap = newAccessLogTestApp(l)
+	accessLogRequest(nap, "/users/5", map[string]string{"User-Agent": "curl/8.0 \"evil\"\r\nGET /forged", "Referer": ""})
+	assert.NoError(t, l.Close())
+	assert.True(t, strings.HasSuffix(buf.String(), `"GET /users/5 HTTP/1.1" 201 5 "-" "curl/8.0 \"evil\"\x0d\x0aGET /forged"`+"\n"), buf.String())
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewAccessLog()
+	l.Format = AccessLogJSON
+	l.Output = &buf
+	nap := newAccessLogTestApp(l)
+	nap.Use(NewRequestID())
+	accessLogRequest(nap, "/users/5?x=1", map[string]string{"User-Agent": "test", "X-Request-ID": "req-1"})
+	assert.NoError(t, l.Close())
+
+	var record AccessLogRecord
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "GET", record.Method)
+	assert.Equal(t, "/users/5", record.Path)
+	assert.Equal(t, "x=1", record.Query)
+	assert.Equal(t, "/users/:id", record.RoutePattern)
+	assert.Equal(t, http.StatusCreated, record.Status)
+	assert.Equal(t, int64(5), record.Bytes)
+	assert.Equal(t, "1.2.3.4", record.ClientIP)
+	assert.Equal(t, "test", record.UserAgent)
+	assert.Equal(t, "req-1", record.RequestID)
+	assert.True(t, record.Latency > 0)
+}
+
+func TestAccessLogTemplateIsEscaped(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewAccessLog()
+	l.Format = `{{.Method}} {{.RoutePattern}} {{.Status}} {{.UserAgent}}`
+	l.Output = &buf
+	nap := newAccessLogTestApp(l)
+	accessLogRequest(nap, "/users/5", map[string]string{"User-Agent": "a\r\nGET /forged 200"})
+	assert.NoError(t, l.Close())
+	assert.Equal(t, "GET /users/:id 201 a\\x0d\\x0aGET /forged 200\n", buf.String())
+}
+
+func TestAccessLogFilters(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewAccessLog()
+	l.Format = `{{.Path}} {{.Status}}`
+	l.Output = &buf
+	l.SkipPaths = []string{"/health", "/static/*"}
+	nap := newAccessLogTestApp(l)
+	for _, path := range []string{"/health", "/static/app.js", "/users/1", "/healthz"} {
+		accessLogRequest(nap, path, nil)
+	}
+	assert.NoError(t, l.Close())
+	assert.Equal(t, "/users/1 201\n/healthz 404\n", buf.String())
+
+	buf.Reset()
+	l = NewAccessLog()
+	l.Format = `{{.Path}} {{.Status}}`
+	l.Output = &buf
+	l.MinStatus = 400
+	nap = newAccessLogTestApp(l)
+	accessLogRequest(nap, "/users/1", nil)
+	accessLogRequest(nap, "/missing", nil)
+	assert.NoError(t, l.Close())
+	assert.Equal(t, "/missing 404\n", buf.String())
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewAccessLog()
+	l.Format = `{{.Path}} {{.Status}}`
+	l.Output = &buf
+	l.SampleRate = 0
+	nap := newAccessLogTestApp(l)
+	for i := 0; i < 10; i++ {
+		accessLogRequest(nap, "/users/1", nil)
+	}
+	// server errors are always logged
+	accessLogRequest(nap, "/fail", nil)
+	assert.NoError(t, l.Close())
+	assert.Equal(t, "/fail 500\n", buf.String())
+}
+
+// blockingWriter blocks the first write until it is released.
+type blockingWriter struct {
+	buf     bytes.Buffer
+	entered chan struct{}
+	release chan struct{}
+	blocked bool
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	if !w.blocked {
+		w.blocked = true
+		close(w.entered)
+		<-w.release
+	}
+	return w.buf.Write(p)
+}
+
+func TestAccessLogDropsWhenQueueIsFull(t *testing.T) {
+	w := &blockingWriter{entered: make(chan struct{}), release: make(chan struct{})}
+	l := NewAccessLog()
+	l.Format = `{{.Path}}`
+	l.Output = w
+	l.QueueSize = 1
+	nap := newAccessLogTestApp(l)
+
+	accessLogRequest(nap, "/users/1", nil)
+	<-w.entered
+	// the writer is blocked, so one line is queued and the others are dropped without blocking the handlers
+	for i := 2; i <= 5; i++ {
+		accessLogRequest(nap, "/users/"+string(rune('0'+i)), nil)
+	}
+	assert.Equal(t, int64(3), l.Dropped())
+
+	close(w.release)
+	assert.NoError(t, l.Close())
+	assert.Equal(t, "/users/1\n/users/2\n", w.buf.String())
+
+	// lines after Close are dropped and Close can be called again
+	accessLogRequest(nap, "/users/6", nil)
+	assert.Equal(t, int64(4), l.Dropped())
+	assert.NoError(t, l.Close())
+}
+
+func TestAccessLogTimeout(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewAccessLog()
+	l.Format = AccessLogJSON
+	l.Output = &buf
+	l.MinStatus = 500
+	nap := newAccessLogTestApp(l)
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	nap.Get("/slow", napnap.Timeout(10*time.Millisecond, func(c *napnap.Context) error {
+		defer close(finished)
+		<-release
+		// the handler still runs after the access log read the context
+		c.Set("late", true)
+		return c.String(http.StatusOK, "late")
+	}))
+	accessLogRequest(nap, "/slow", nil)
+	close(release)
+	<-finished
+	assert.NoError(t, l.Close())
+
+	var record AccessLogRecord
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, http.StatusServiceUnavailable, record.Status)
+	assert.Equal(t, "/slow", record.RoutePattern)
+}
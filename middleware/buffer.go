@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"github.com/jasonsoft/napnap"
+)
+
+// Buffer is a middleware handler that holds the response in memory up to Limit bytes, so handlers and
+// the middleware which are registered after Buffer can still change the status and the headers after next.
+// Use napnap.Buffer to buffer a single route.
+type Buffer struct {
+	// Limit is the maximum size in bytes of the buffered body.  When it is exceeded, the response is streamed.
+	Limit int
+}
+
+// NewBuffer returns a new instance of Buffer
+func NewBuffer(limit int) *Buffer {
+	return &Buffer{
+		Limit: limit,
+	}
+}
+
+// Invoke function is a middleware entry
+func (b *Buffer) Invoke(c *napnap.Context, next napnap.HandlerFunc) {
+	_ = napnap.Buffer(b.Limit, next)(c)
+}
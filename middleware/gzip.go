@@ -51,6 +51,16 @@ func (grw gzipResponseWriter) Write(b []byte) (int, error) {
 	return grw.napWriter.Write(b)
 }
 
+// Flush writes the compressed data to the client.
+func (grw gzipResponseWriter) Flush() {
+	if len(grw.Header().Get(headerContentEncoding)) > 0 {
+		_ = grw.gz.Flush()
+	}
+	if flusher, ok := grw.napWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 // GzipMiddleware struct is gzip middlware
 type GzipMiddleware struct {
 	pool sync.Pool
@@ -121,4 +131,6 @@ func (h *GzipMiddleware) Invoke(c *napnap.Context, next napnap.HandlerFunc) {
 	_ = next(c)
 
 	_ = gz.Close()
+	// restore the writer, so the middleware before gzip reads the compressed size
+	c.Writer = w
 }
@@ -1,13 +1,18 @@
 package middleware
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/jasonsoft/napnap"
 )
 
-// Health is health middleware struct
+// Health is health middleware struct.  It answers "/health" with "OK", and with 503 and the state while NapNap is
+// draining or stopped, so load balancers stop sending traffic before the servers are drained.
 type Health struct {
+	// WaitReady also answers 503 until a server which was started by the Run methods is listening.  It must not be
+	// set when the NapNap is served by http.ListenAndServe or another server.
+	WaitReady bool
 }
 
 // NewHealth returns Health middlware instance
@@ -18,6 +23,11 @@ func NewHealth() *Health {
 // Invoke function is a middleware entry
 func (h *Health) Invoke(c *napnap.Context, next napnap.HandlerFunc) {
 	if strings.EqualFold(c.Request.URL.Path, "/health") {
+		state := c.NapNap.State()
+		if state == napnap.StateDraining || state == napnap.StateStopped || (h.WaitReady && state == napnap.StateStarting) {
+			_ = c.String(http.StatusServiceUnavailable, state.String())
+			return
+		}
 		_ = c.String(200, "OK")
 	} else {
 		_ = next(c)
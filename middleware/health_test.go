@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jasonsoft/napnap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	// the instance is served without the Run methods, so it never becomes ready
+	nap := napnap.New()
+	nap.Use(NewHealth())
+	ts := httptest.NewServer(nap)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/health")
+	assert.NoError(t, err)
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "OK", string(b))
+}
+
+func TestHealthReportsState(t *testing.T) {
+	nap := napnap.New()
+	nap.ShutdownSignals = nil
+	nap.Use(&Health{WaitReady: true})
+
+	check := func() (int, string) {
+		req, _ := http.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+		nap.ServeHTTP(w, req)
+		b, _ := io.ReadAll(w.Body)
+		return w.Code, string(b)
+	}
+
+	code, body := check()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "starting", body)
+
+	listening := make(chan net.Addr, 1)
+	nap.OnListening(func(addr net.Addr) {
+		listening <- addr
+	})
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- nap.Run(napnap.NewHTTPEngine("127.0.0.1:0"))
+	}()
+	<-listening
+	code, body = check()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "OK", body)
+
+	nap.OnShutdown(func(ctx context.Context) error {
+		code, body = check()
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "draining", body)
+		return nil
+	})
+	assert.NoError(t, nap.Shutdown(context.Background()))
+	assert.NoError(t, <-runErr)
+	code, body = check()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "stopped", body)
+}
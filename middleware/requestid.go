@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/jasonsoft/napnap"
+)
+
+// RequestID is a middleware handler that accepts the request id from the client or generates a UUIDv7.
+// The id can be read from Context.RequestID() and is echoed in the response header.
+type RequestID struct {
+	// Header is the name of the request and response header.  Default value is "X-Request-ID"
+	Header string
+	// MaxLength is the maximum length of an incoming id.  Default value is 64
+	MaxLength int
+	// Generator creates a new id when the client doesn't send a valid one.  Default value generates UUIDv7.
+	Generator func() string
+}
+
+// NewRequestID returns a new instance of RequestID
+func NewRequestID() *RequestID {
+	return &RequestID{
+		Header:    "X-Request-ID",
+		MaxLength: 64,
+		Generator: newUUIDv7,
+	}
+}
+
+// Invoke function is a middleware entry
+func (r *RequestID) Invoke(c *napnap.Context, next napnap.HandlerFunc) {
+	id := c.RequestHeader(r.Header)
+	if !isValidRequestID(id, r.MaxLength) {
+		id = r.Generator()
+	}
+	c.SetRequestID(id)
+	c.RespHeader(r.Header, id)
+	_ = next(c)
+}
+
+// isValidRequestID only accepts ids which are safe to be written to logs and headers.
+func isValidRequestID(id string, maxLength int) bool {
+	if len(id) == 0 || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		char := id[i]
+		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') {
+			continue
+		}
+		switch char {
+		case '-', '_', '.', ':', '+', '/', '=':
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// newUUIDv7 returns a UUID version 7 which is ordered by time (RFC 9562).
+func newUUIDv7() string {
+	var b [16]byte
+	_, _ = rand.Read(b[6:])
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16|uint64(binary.BigEndian.Uint16(b[6:8])))
+	b[6] = 0x70 | b[6]&0x0f
+	b[8] = 0x80 | b[8]&0x3f
+
+	buf := make([]byte, 36)
+	hex.Encode(buf, b[:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf)
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jasonsoft/napnap"
+	"github.com/stretchr/testify/assert"
+)
+
+var uuidv7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewUUIDv7(t *testing.T) {
+	before := time.Now().UnixMilli()
+	id := newUUIDv7()
+	after := time.Now().UnixMilli()
+
+	// version 7 and variant 10xx
+	assert.Regexp(t, uuidv7Pattern, id)
+
+	// the first 48 bits are the unix time in milliseconds
+	var ms int64
+	for _, ch := range strings.ReplaceAll(id[:13], "-", "") {
+		ms = ms<<4 | int64(strings.IndexRune("0123456789abcdef", ch))
+	}
+	assert.True(t, ms >= before && ms <= after)
+
+	// ids are ordered by time
+	prev := newUUIDv7()
+	time.Sleep(2 * time.Millisecond)
+	assert.True(t, newUUIDv7() > prev)
+	assert.NotEqual(t, newUUIDv7(), newUUIDv7())
+}
+
+func TestIsValidRequestID(t *testing.T) {
+	assert.True(t, isValidRequestID("abc-123_DEF.4:5+6/7=", 64))
+	assert.False(t, isValidRequestID("", 64))
+	assert.False(t, isValidRequestID(strings.Repeat("a", 65), 64))
+	assert.True(t, isValidRequestID(strings.Repeat("a", 64), 64))
+	assert.False(t, isValidRequestID("abc\r\nSet-Cookie: x", 64))
+	assert.False(t, isValidRequestID("abc def", 64))
+	assert.False(t, isValidRequestID("abc\x00", 64))
+	assert.False(t, isValidRequestID("日本", 64))
+}
+
+func TestRequestID(t *testing.T) {
+	var id string
+	nap := napnap.New()
+	nap.Use(NewRequestID())
+	nap.Get("/", func(c *napnap.Context) error {
+		id = c.RequestID()
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "client-id-1")
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, "client-id-1", id)
+	assert.Equal(t, "client-id-1", w.Header().Get("X-Request-ID"))
+
+	// invalid ids are replaced
+	req.Header.Set("X-Request-ID", strings.Repeat("a", 65))
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Regexp(t, uuidv7Pattern, id)
+	assert.Equal(t, id, w.Header().Get("X-Request-ID"))
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/jasonsoft/napnap"
+)
+
+// Timeout is a middleware handler that bounds the execution of the rest of the middleware stack and the handlers.
+// Use napnap.Timeout to bound a single route.
+type Timeout struct {
+	Duration time.Duration
+	// Error is passed to ErrorHandler when the deadline passes.  Default value is napnap.ErrHandlerTimeout (503).
+	Error error
+}
+
+// NewTimeout returns a new instance of Timeout
+func NewTimeout(d time.Duration) *Timeout {
+	return &Timeout{
+		Duration: d,
+		Error:    napnap.ErrHandlerTimeout,
+	}
+}
+
+// Invoke function is a middleware entry
+func (t *Timeout) Invoke(c *napnap.Context, next napnap.HandlerFunc) {
+	// the rest of the stack handles its errors itself, so next never returns one
+	_ = napnap.TimeoutWithError(t.Duration, t.Error, next)(c)
+}
@@ -0,0 +1,495 @@
+// reference:
+// https://tus.io/protocols/resumable-upload
+
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jasonsoft/napnap"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	tusContent    = "application/offset+octet-stream"
+)
+
+var (
+	// ErrTusUploadNotFound is returned by a TusStore when the upload doesn't exist.
+	ErrTusUploadNotFound = errors.New("tus: upload not found")
+	// ErrTusUploadLocked is returned by a TusStore when another request is appending to the upload.
+	ErrTusUploadLocked = errors.New("tus: upload is locked")
+	// ErrTusOffsetMismatch is returned by a TusStore when the offset doesn't match the stored bytes.
+	ErrTusOffsetMismatch = errors.New("tus: offset mismatch")
+)
+
+// TusUpload describes a resumable upload.
+type TusUpload struct {
+	ID        string            `json:"id"`
+	Size      int64             `json:"size"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Completed returns true when all bytes of the upload were received.
+func (u *TusUpload) Completed() bool {
+	return u.Offset == u.Size
+}
+
+// TusStore keeps the state and the content of resumable uploads.
+type TusStore interface {
+	// Create creates a new empty upload.
+	Create(ctx context.Context, upload TusUpload) error
+	// Info returns the upload of the id or ErrTusUploadNotFound.
+	Info(ctx context.Context, id string) (TusUpload, error)
+	// Append writes the content at the offset and returns the number of bytes which were stored.
+	// The bytes which were received before an error must be stored as well.
+	Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	// Delete removes the upload and its content.
+	Delete(ctx context.Context, id string) error
+}
+
+// TusLocalStore stores resumable uploads in a local directory.
+// The content of an upload is kept in "<id>.bin" and its state in "<id>.info".
+type TusLocalStore struct {
+	dir   string
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+// NewTusLocalStore returns a local tus store.  The directory is created if it doesn't exist.
+func NewTusLocalStore(dir string) (*TusLocalStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &TusLocalStore{
+		dir:   dir,
+		locks: map[string]bool{},
+	}, nil
+}
+
+// Path returns the path of the content of the upload.
+func (s *TusLocalStore) Path(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+// Create creates a new empty upload.
+func (s *TusLocalStore) Create(ctx context.Context, upload TusUpload) error {
+	if !isValidTusID(upload.ID) {
+		return errors.New("tus: invalid upload id")
+	}
+	f, err := os.OpenFile(s.Path(upload.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return s.writeInfo(upload)
+}
+
+// Info returns the upload of the id.
+func (s *TusLocalStore) Info(ctx context.Context, id string) (TusUpload, error) {
+	var upload TusUpload
+	if !isValidTusID(id) {
+		return upload, ErrTusUploadNotFound
+	}
+	b, err := os.ReadFile(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return upload, ErrTusUploadNotFound
+	}
+	if err != nil {
+		return upload, err
+	}
+	err = json.Unmarshal(b, &upload)
+	return upload, err
+}
+
+// Append writes the content at the offset.  Only one request can append to an upload at the same time.
+func (s *TusLocalStore) Append(ctx context.Context, id string, offset int64, r io.Reader) (n int64, err error) {
+	if err = s.lock(id); err != nil {
+		return 0, err
+	}
+	defer s.unlock(id)
+
+	upload, err := s.Info(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if upload.Offset != offset {
+		return 0, ErrTusOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.Path(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return 0, err
+	}
+	n, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	// keep the bytes which were received even if the client went away
+	if n > 0 {
+		upload.Offset += n
+		if werr := s.writeInfo(upload); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// Delete removes the upload and its content.
+func (s *TusLocalStore) Delete(ctx context.Context, id string) error {
+	if !isValidTusID(id) {
+		return ErrTusUploadNotFound
+	}
+	err := os.Remove(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return ErrTusUploadNotFound
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Remove(s.Path(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Cleanup removes the uploads which were expired before now.  It can be called periodically.
+func (s *TusLocalStore) Cleanup(ctx context.Context, now time.Time) error {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.info"))
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		id := strings.TrimSuffix(filepath.Base(match), ".info")
+		upload, err := s.Info(ctx, id)
+		if err != nil || upload.Completed() || upload.ExpiresAt.IsZero() || upload.ExpiresAt.After(now) {
+			continue
+		}
+		_ = s.Delete(ctx, id)
+	}
+	return nil
+}
+
+func (s *TusLocalStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
+
+func (s *TusLocalStore) writeInfo(upload TusUpload) error {
+	b, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(upload.ID) + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(upload.ID))
+}
+
+func (s *TusLocalStore) lock(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locks[id] {
+		return ErrTusUploadLocked
+	}
+	s.locks[id] = true
+	return nil
+}
+
+func (s *TusLocalStore) unlock(id string) {
+	s.mu.Lock()
+	delete(s.locks, id)
+	s.mu.Unlock()
+}
+
+// Tus is a middleware handler that implements the core protocol of tus 1.0 with the creation,
+// expiration and termination extensions.  The size of each PATCH request is limited by NapNap.MaxRequestBodySize.
+type Tus struct {
+	// Prefix is the path where uploads are created, such as "/files".
+	Prefix string
+	Store  TusStore
+	// MaxSize is the maximum size in bytes of an upload.  Default value is 0 which means no limit.
+	MaxSize int64
+	// Expiration is how long an incomplete upload is kept after it was created.  Default value is 24 hours.
+	Expiration time.Duration
+	// OnComplete is called when all bytes of an upload were received.
+	OnComplete func(c *napnap.Context, upload TusUpload) error
+}
+
+// NewTus returns a new instance of Tus
+func NewTus(prefix string, store TusStore) *Tus {
+	return &Tus{
+		Prefix:     strings.TrimSuffix(prefix, "/"),
+		Store:      store,
+		Expiration: 24 * time.Hour,
+	}
+}
+
+// Invoke function is a middleware entry
+func (t *Tus) Invoke(c *napnap.Context, next napnap.HandlerFunc) {
+	p := c.Request.URL.Path
+	var id string
+	switch {
+	case p == t.Prefix || p == t.Prefix+"/":
+	case strings.HasPrefix(p, t.Prefix+"/") && !strings.Contains(p[len(t.Prefix)+1:], "/"):
+		id = p[len(t.Prefix)+1:]
+	default:
+		_ = next(c)
+		return
+	}
+
+	// clients which can't send PATCH or DELETE tunnel them through POST
+	method := c.Request.Method
+	if override := c.RequestHeader("X-HTTP-Method-Override"); len(override) > 0 && method == "POST" {
+		method = strings.ToUpper(override)
+	}
+
+	c.RespHeader("Tus-Resumable", tusVersion)
+	if method == "OPTIONS" {
+		c.RespHeader("Tus-Version", tusVersion)
+		c.RespHeader("Tus-Extension", tusExtensions)
+		if t.MaxSize > 0 {
+			c.RespHeader("Tus-Max-Size", strconv.FormatInt(t.MaxSize, 10))
+		}
+		c.SetStatus(http.StatusNoContent)
+		return
+	}
+	if c.RequestHeader("Tus-Resumable") != tusVersion {
+		c.RespHeader("Tus-Version", tusVersion)
+		_ = c.String(http.StatusPreconditionFailed, "unsupported tus version")
+		return
+	}
+
+	switch {
+	case method == "POST" && len(id) == 0:
+		t.create(c)
+	case method == "HEAD" && len(id) > 0:
+		t.head(c, id)
+	case method == "PATCH" && len(id) > 0:
+		t.patch(c, id)
+	case method == "DELETE" && len(id) > 0:
+		t.terminate(c, id)
+	default:
+		_ = c.String(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (t *Tus) create(c *napnap.Context) {
+	size, err := strconv.ParseInt(c.RequestHeader("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		_ = c.String(http.StatusBadRequest, "invalid Upload-Length")
+		return
+	}
+	if t.MaxSize > 0 && size > t.MaxSize {
+		_ = c.String(http.StatusRequestEntityTooLarge, "upload is too large")
+		return
+	}
+	metadata, err := parseTusMetadata(c.RequestHeader("Upload-Metadata"))
+	if err != nil {
+		_ = c.String(http.StatusBadRequest, "invalid Upload-Metadata")
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		tusServerError(c, err)
+		return
+	}
+	upload := TusUpload{
+		ID:        hex.EncodeToString(b),
+		Size:      size,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(t.Expiration).UTC(),
+	}
+	if err = t.Store.Create(c.StdContext(), upload); err != nil {
+		tusServerError(c, err)
+		return
+	}
+
+	c.RespHeader("Location", t.Prefix+"/"+upload.ID)
+	c.RespHeader("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	c.SetStatus(http.StatusCreated)
+
+	if upload.Completed() {
+		t.complete(c, upload)
+	}
+}
+
+func (t *Tus) head(c *napnap.Context, id string) {
+	upload, ok := t.info(c, id)
+	if !ok {
+		return
+	}
+	c.RespHeader("Cache-Control", "no-store")
+	c.RespHeader("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.RespHeader("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	if len(upload.Metadata) > 0 {
+		c.RespHeader("Upload-Metadata", formatTusMetadata(upload.Metadata))
+	}
+	if !upload.Completed() {
+		c.RespHeader("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	}
+	c.SetStatus(http.StatusOK)
+}
+
+func (t *Tus) patch(c *napnap.Context, id string) {
+	if c.ContentType() != tusContent {
+		_ = c.String(http.StatusUnsupportedMediaType, "Content-Type must be "+tusContent)
+		return
+	}
+	offset, err := strconv.ParseInt(c.RequestHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		_ = c.String(http.StatusBadRequest, "invalid Upload-Offset")
+		return
+	}
+	upload, ok := t.info(c, id)
+	if !ok {
+		return
+	}
+	if upload.Offset != offset {
+		_ = c.String(http.StatusConflict, "Upload-Offset mismatch")
+		return
+	}
+
+	// the body can't grow the upload beyond its length
+	n, err := t.Store.Append(c.StdContext(), id, offset, io.LimitReader(c.Request.Body, upload.Size-offset))
+	upload.Offset += n
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			c.RespHeader("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+			_ = c.String(http.StatusRequestEntityTooLarge, "chunk is too large")
+		case err == ErrTusUploadLocked:
+			_ = c.String(http.StatusLocked, err.Error())
+		case err == ErrTusOffsetMismatch:
+			_ = c.String(http.StatusConflict, "Upload-Offset mismatch")
+		case err == ErrTusUploadNotFound:
+			_ = c.String(http.StatusNotFound, err.Error())
+		default:
+			tusServerError(c, err)
+		}
+		return
+	}
+
+	c.RespHeader("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if !upload.Completed() {
+		c.RespHeader("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	}
+	c.SetStatus(http.StatusNoContent)
+
+	if upload.Completed() {
+		t.complete(c, upload)
+	}
+}
+
+func (t *Tus) terminate(c *napnap.Context, id string) {
+	err := t.Store.Delete(c.StdContext(), id)
+	switch err {
+	case nil:
+		c.SetStatus(http.StatusNoContent)
+	case ErrTusUploadNotFound:
+		_ = c.String(http.StatusNotFound, err.Error())
+	default:
+		tusServerError(c, err)
+	}
+}
+
+// info loads the upload and writes the error response if it doesn't exist or has expired.
+func (t *Tus) info(c *napnap.Context, id string) (TusUpload, bool) {
+	upload, err := t.Store.Info(c.StdContext(), id)
+	if err == ErrTusUploadNotFound {
+		_ = c.String(http.StatusNotFound, err.Error())
+		return upload, false
+	}
+	if err != nil {
+		tusServerError(c, err)
+		return upload, false
+	}
+	if !upload.Completed() && !upload.ExpiresAt.IsZero() && time.Now().After(upload.ExpiresAt) {
+		_ = t.Store.Delete(c.StdContext(), id)
+		_ = c.String(http.StatusGone, "upload has expired")
+		return upload, false
+	}
+	return upload, true
+}
+
+func (t *Tus) complete(c *napnap.Context, upload TusUpload) {
+	if t.OnComplete == nil {
+		return
+	}
+	if err := t.OnComplete(c, upload); err != nil {
+		tusServerError(c, err)
+	}
+}
+
+// tusServerError logs the error and answers 500 without the error, so paths of the store aren't sent to the client.
+func tusServerError(c *napnap.Context, err error) {
+	c.Logger().Error("tus: request failed", "error", err)
+	_ = c.String(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+// parseTusMetadata parses "key base64value,key2" pairs of the Upload-Metadata header.
+func parseTusMetadata(header string) (map[string]string, error) {
+	if len(header) == 0 {
+		return nil, nil
+	}
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		key, encoded, _ := strings.Cut(pair, " ")
+		if len(key) == 0 {
+			return nil, errors.New("tus: empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func formatTusMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		if len(value) == 0 {
+			pairs = append(pairs, key)
+		} else {
+			pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func isValidTusID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
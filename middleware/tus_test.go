@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jasonsoft/napnap"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTusTestApp(t *testing.T) (*napnap.NapNap, *Tus, *TusLocalStore) {
+	store, err := NewTusLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	tus := NewTus("/files", store)
+	nap := napnap.New()
+	nap.Use(tus)
+	return nap, tus, store
+}
+
+func tusRequest(nap *napnap.NapNap, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	return w
+}
+
+func createTusUpload(t *testing.T, nap *napnap.NapNap, size string) string {
+	w := tusRequest(nap, "POST", "/files", "", map[string]string{"Upload-Length": size})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	location := w.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, "/files/"))
+	return location
+}
+
+func TestTusOptions(t *testing.T) {
+	nap, tus, _ := newTusTestApp(t)
+	tus.MaxSize = 1024
+
+	// discovery doesn't require the Tus-Resumable header
+	req, _ := http.NewRequest("OPTIONS", "/files", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, tusVersion, w.Header().Get("Tus-Version"))
+	assert.Equal(t, tusExtensions, w.Header().Get("Tus-Extension"))
+	assert.Equal(t, "1024", w.Header().Get("Tus-Max-Size"))
+}
+
+func TestTusCreate(t *testing.T) {
+	nap, tus, store := newTusTestApp(t)
+	tus.MaxSize = 100
+
+	w := tusRequest(nap, "POST", "/files", "", map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename d29ybGQudHh0,empty",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Upload-Expires"))
+	id := strings.TrimPrefix(w.Header().Get("Location"), "/files/")
+	upload, err := store.Info(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), upload.Size)
+	assert.Equal(t, "world.txt", upload.Metadata["filename"])
+
+	// deferred lengths aren't supported
+	w = tusRequest(nap, "POST", "/files", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = tusRequest(nap, "POST", "/files", "", map[string]string{"Upload-Length": "101"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = tusRequest(nap, "POST", "/files", "", map[string]string{"Upload-Length": "10", "Tus-Resumable": "0.2.0"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestTusHeadAndPatch(t *testing.T) {
+	nap, tus, _ := newTusTestApp(t)
+	var completed TusUpload
+	tus.OnComplete = func(c *napnap.Context, upload TusUpload) error {
+		completed = upload
+		return nil
+	}
+	location := createTusUpload(t, nap, "11")
+
+	w := tusRequest(nap, "HEAD", location, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", w.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = tusRequest(nap, "PATCH", location, "hello", map[string]string{"Content-Type": tusContent, "Upload-Offset": "0"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+
+	w = tusRequest(nap, "PATCH", location, " world", map[string]string{"Content-Type": tusContent, "Upload-Offset": "0"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = tusRequest(nap, "PATCH", location, " world", map[string]string{"Content-Type": "text/plain", "Upload-Offset": "5"})
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = tusRequest(nap, "PATCH", location, " world", map[string]string{"Content-Type": tusContent, "Upload-Offset": "5"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "11", w.Header().Get("Upload-Offset"))
+	assert.True(t, completed.Completed())
+	assert.Equal(t, int64(11), completed.Size)
+
+	w = tusRequest(nap, "PATCH", "/files/00000000000000000000000000000000", "x", map[string]string{"Content-Type": tusContent, "Upload-Offset": "0"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTusPatchTooLarge(t *testing.T) {
+	nap, _, _ := newTusTestApp(t)
+	location := createTusUpload(t, nap, "100")
+	nap.MaxRequestBodySize = 10
+
+	w := tusRequest(nap, "PATCH", location, strings.Repeat("a", 20), map[string]string{"Content-Type": tusContent, "Upload-Offset": "0"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	// the received bytes are kept, so the client can resume
+	assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+
+	w = tusRequest(nap, "HEAD", location, "", nil)
+	assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+}
+
+func TestTusTerminate(t *testing.T) {
+	nap, _, _ := newTusTestApp(t)
+	location := createTusUpload(t, nap, "10")
+
+	w := tusRequest(nap, "DELETE", location, "", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = tusRequest(nap, "HEAD", location, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = tusRequest(nap, "DELETE", location, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTusMethodOverride(t *testing.T) {
+	nap, _, _ := newTusTestApp(t)
+	location := createTusUpload(t, nap, "10")
+
+	// the override is only accepted on POST
+	w := tusRequest(nap, "HEAD", location, "", map[string]string{"X-HTTP-Method-Override": "DELETE"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = tusRequest(nap, "POST", location, "", map[string]string{"X-HTTP-Method-Override": "DELETE"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = tusRequest(nap, "HEAD", location, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTusExpiration(t *testing.T) {
+	nap, tus, store := newTusTestApp(t)
+	tus.Expiration = -time.Minute
+	location := createTusUpload(t, nap, "10")
+
+	w := tusRequest(nap, "HEAD", location, "", nil)
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	// the expired upload was removed
+	_, err := store.Info(context.Background(), strings.TrimPrefix(location, "/files/"))
+	assert.Equal(t, ErrTusUploadNotFound, err)
+}
+
+func TestTusLocalStoreCleanup(t *testing.T) {
+	store, err := NewTusLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now()
+
+	expired := TusUpload{ID: strings.Repeat("a", 32), Size: 10, ExpiresAt: now.Add(-time.Minute)}
+	active := TusUpload{ID: strings.Repeat("b", 32), Size: 10, ExpiresAt: now.Add(time.Minute)}
+	completed := TusUpload{ID: strings.Repeat("c", 32), Size: 0, ExpiresAt: now.Add(-time.Minute)}
+	for _, upload := range []TusUpload{expired, active, completed} {
+		assert.NoError(t, store.Create(ctx, upload))
+	}
+
+	assert.NoError(t, store.Cleanup(ctx, now))
+	_, err = store.Info(ctx, expired.ID)
+	assert.Equal(t, ErrTusUploadNotFound, err)
+	_, err = store.Info(ctx, active.ID)
+	assert.NoError(t, err)
+	_, err = store.Info(ctx, completed.ID)
+	assert.NoError(t, err)
+}
+
+// failingTusStore fails like a broken disk.
+type failingTusStore struct {
+	*TusLocalStore
+}
+
+func (s failingTusStore) Create(ctx context.Context, upload TusUpload) error {
+	return &fs.PathError{Op: "open", Path: "/var/lib/uploads/" + upload.ID, Err: fs.ErrPermission}
+}
+
+func TestTusStoreErrorIsNotSent(t *testing.T) {
+	store, err := NewTusLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	nap := napnap.New()
+	nap.Use(NewTus("/files", failingTusStore{store}))
+
+	w := tusRequest(nap, "POST", "/files", "", map[string]string{"Upload-Length": "5"})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), w.Body.String())
+}
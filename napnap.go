@@ -1,27 +1,23 @@
 package napnap
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"html/template"
+	"log/slog"
+	"net"
 	"net/http"
-	"path"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"golang.org/x/crypto/acme/autocert"
 )
 
-var (
-	_logger *logger
-)
-
-func init() {
-	_logger = &logger{
-		mode: off,
-	}
-}
-
 // HandlerFunc defines a function to server HTTP requests
 type HandlerFunc func(c *Context) error
 
@@ -62,26 +58,82 @@ func WrapHandler(h http.Handler) HandlerFunc {
 
 // NapNap is root level of framework instance
 type NapNap struct {
-	pool             sync.Pool
-	handlers         []MiddlewareHandler
-	middleware       middleware
-	template         *template.Template
-	templateRootPath string
-	router           *router
+	pool       sync.Pool
+	handlers   []MiddlewareHandler
+	middleware middleware
+	renderer   Renderer
+	renderers  map[string]Renderer
+	router     *router
+
+	lifecycleMu    sync.Mutex
+	state          atomic.Int32
+	servers        map[*http.Server]*trackedServer
+	startHooks     []func(ctx context.Context) error
+	listeningHooks []func(addr net.Addr)
+	shutdownHooks  []func(ctx context.Context) error
+	stoppedHooks   []func()
+	startOnce      sync.Once
+	startErr       error
+	shutdownOnce   sync.Once
+	shutdownCh     chan struct{}
+	shutdownDone   chan struct{}
+	shutdownErr    error
+	drainCtx       context.Context
+	drainCancel    context.CancelFunc
+	signalOnce     sync.Once
+
+	trustedProxiesMu      sync.RWMutex
+	trustedProxiesSource  []string
+	trustedProxyNetsCache []*net.IPNet
 
 	MaxRequestBodySize int64
-	ErrorHandler       ErrorHandler
-	NotFoundHandler    HandlerFunc
+	SecureJSONPrefix   string
+	// Debug enables checks which are too expensive for production.  Contexts aren't recycled after requests, so a context
+	// which is used by a goroutine after its request was finished panics instead of reading the data of another request.
+	Debug bool
+	// TrustedProxies is a list of ips or cidrs of the reverse proxies whose forwarding headers can be trusted.
+	// Default value is empty which means no proxy is trusted.
+	TrustedProxies []string
+	// RemoteIPHeaders is the header chain which is checked in order to find the client ip for trusted proxies.
+	// Default value is ["X-Forwarded-For", "X-Real-Ip"].  "CF-Connecting-IP" can be added for cloudflare and "Forwarded"
+	// for proxies which replace the Forwarded header of the client.
+	RemoteIPHeaders []string
+	// CookieKeys holds the secrets for signed and encrypted cookies.
+	CookieKeys *KeyRing
+	// Logger is used by napnap and Context.Logger().  Default value writes text to stderr with the level of LogLevel.
+	Logger Logger
+	// LogLevel controls the level of the default logger at runtime.  Default value is info.
+	LogLevel *slog.LevelVar
+	// ShutdownTimeout is the grace period for the active requests when the server is stopped by a signal.
+	// Default value is 10 seconds
+	ShutdownTimeout time.Duration
+	// ShutdownSignals are the signals which gracefully stop the servers started by the Run methods.
+	// Default value is SIGINT and SIGTERM.  Set it to nil to handle the signals yourself.
+	ShutdownSignals []os.Signal
+	// ErrorHandler handles the errors which are returned by handlers, such as DefaultErrorHandler.  Default value is nil
+	// which logs server errors and only sends the status of errors which carry one.
+	ErrorHandler    ErrorHandler
+	NotFoundHandler HandlerFunc
 }
 
 // New returns a new NapNap instance
 func New(mHandlers ...MiddlewareHandler) *NapNap {
+	logLevel := new(slog.LevelVar)
 	nap := &NapNap{
 		handlers:           mHandlers,
 		middleware:         build(mHandlers),
 		MaxRequestBodySize: 10485760, // default 10MB for request body size
+		SecureJSONPrefix:   "while(1);",
+		Logger:             newDefaultLogger(logLevel),
+		LogLevel:           logLevel,
+		ShutdownTimeout:    defaultShutdownTimeout,
+		ShutdownSignals:    []os.Signal{os.Interrupt, syscall.SIGTERM},
+		shutdownCh:         make(chan struct{}),
+		shutdownDone:       make(chan struct{}),
 	}
 
+	nap.drainCtx, nap.drainCancel = context.WithCancel(context.Background())
+
 	nap.pool.New = func() interface{} {
 		rw := NewResponseWriter()
 		return NewContext(nap, nil, rw)
@@ -156,37 +208,38 @@ func (nap *NapNap) Head(path string, handler HandlerFunc) {
 	nap.router.Add(HEAD, path, handler)
 }
 
-// SetTemplate function allows user to set their own template instance.
+// SetTemplate function allows user to set their own template instance.  Views are rendered by their template names.
 func (nap *NapNap) SetTemplate(t *template.Template) {
-	nap.template = t
+	nap.renderer = templateRenderer{t: t}
 }
 
-// SetRender function allows user to set template location.
-func (nap *NapNap) SetRender(templateRootPath string) {
-	sharedTemplatePath := path.Join(templateRootPath, "shares/*")
-	tmpl, err := template.ParseGlob(sharedTemplatePath)
-	template := template.Must(tmpl, err)
-	if template == nil {
-		_logger.debug("no template")
-		template = template.New("")
+// SetRender function allows user to set template location.  The views in "views" and the shared templates
+// in "shares" are parsed by a HTMLEngine, and the error is returned instead of panicking.
+func (nap *NapNap) SetRender(templateRootPath string) error {
+	engine := NewHTMLEngine(os.DirFS(templateRootPath))
+	if err := engine.Load(); err != nil {
+		return err
 	}
-	nap.template = template
-	nap.templateRootPath = templateRootPath
+	nap.renderer = engine
+	return nil
 }
 
-// Run will run http server
+// Run will run http server.  It returns nil after the server was drained by Shutdown.
 func (nap *NapNap) Run(engine *Server) error {
 	engine.Handler = nap
-	return engine.ListenAndServe()
+	return nap.serve(engine.Server, engine, nil)
 }
 
-// RunTLS will run http/2 server
+// RunTLS will run http/2 server.  It returns nil after the server was drained by Shutdown.
 func (nap *NapNap) RunTLS(engine *Server) error {
 	engine.Handler = nap
-	return engine.ListenAndServeTLS(engine.Config.TLSCertFile, engine.Config.TLSKeyFile)
+	return nap.serve(engine.Server, engine, func(ln net.Listener) error {
+		return engine.ServeTLS(ln, engine.Config.TLSCertFile, engine.Config.TLSKeyFile)
+	})
 }
 
-// RunAutoTLS will run http/2 server
+// RunAutoTLS will run http/2 server with certificates from let's encrypt.  The http server on ":http" answers
+// the acme challenges and is stopped together with the https server.
 func (nap *NapNap) RunAutoTLS(engine *Server) error {
 
 	whiteLists := []string{}
@@ -204,36 +257,45 @@ func (nap *NapNap) RunAutoTLS(engine *Server) error {
 		m.Cache = autocert.DirCache(engine.Config.CertCachePath)
 	}
 
-	go http.ListenAndServe(":http", m.HTTPHandler(nap))
+	httpServer := &http.Server{
+		Addr:    ":http",
+		Handler: m.HTTPHandler(nap),
+	}
 
 	// https' settings
 	engine.Addr = ":https"
 	engine.TLSConfig = &tls.Config{GetCertificate: m.GetCertificate}
 	engine.Handler = nap
-	return engine.ListenAndServeTLS("", "")
+
+	return nap.serveAll([]*http.Server{httpServer, engine.Server}, []func() error{
+		func() error {
+			return nap.serve(httpServer, nil, nil)
+		},
+		func() error {
+			return nap.serve(engine.Server, engine, func(ln net.Listener) error {
+				return engine.ServeTLS(ln, "", "")
+			})
+		},
+	})
 }
 
-// RunAll will listen on multiple port
+// RunAll will listen on multiple port.  It returns the first error and stops the other servers,
+// or nil after the servers were drained by Shutdown.
 func (nap *NapNap) RunAll(addrs []string) error {
 	if len(addrs) == 0 {
 		return errors.New("addrs can't be empty")
 	}
 
-	wg := &sync.WaitGroup{}
-
+	servers := make([]*http.Server, 0, len(addrs))
+	serve := make([]func() error, 0, len(addrs))
 	for _, addr := range addrs {
-		wg.Add(1)
-		go func(newAddr string) {
-			err := http.ListenAndServe(newAddr, nap)
-			if err != nil {
-				panic(err)
-			}
-			wg.Done()
-		}(addr)
+		srv := &http.Server{Addr: addr, Handler: nap}
+		servers = append(servers, srv)
+		serve = append(serve, func() error {
+			return nap.serve(srv, nil, nil)
+		})
 	}
-
-	wg.Wait()
-	return nil
+	return nap.serveAll(servers, serve)
 }
 
 // Conforms to the http.Handler interface.
@@ -242,6 +304,14 @@ func (nap *NapNap) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	c := nap.pool.Get().(*Context)
 	c.reset(w, req)
 	_ = nap.middleware.Execute(c)
+	c.finish()
+	if c.detached {
+		return
+	}
+	if nap.Debug {
+		c.release()
+		return
+	}
 	nap.pool.Put(c)
 }
 
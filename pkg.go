@@ -21,6 +21,39 @@ func FromContext(ctx gcontext.Context) (*Context, bool) {
 	return nil, false
 }
 
+// stdContext exposes the napnap context and the typed values of its store to the libraries which only accept
+// the standard context.  The values are copied when it is created, so it never reads the store of a later request
+// which reuses the context.
+type stdContext struct {
+	gcontext.Context
+	c      *Context
+	values map[interface{}]interface{}
+}
+
 func newGContext(ctx gcontext.Context, c *Context) gcontext.Context {
-	return gcontext.WithValue(ctx, ctxKey, c)
+	var values map[interface{}]interface{}
+	for key, val := range c.store {
+		if _, ok := key.(typedKey); !ok {
+			continue
+		}
+		if values == nil {
+			values = make(map[interface{}]interface{})
+		}
+		values[key] = val
+	}
+	return stdContext{Context: ctx, c: c, values: values}
+}
+
+// Value returns the napnap context for ctxKey, the value of a Key or the value of the parent context.
+// String keys of Set aren't exposed, so they never collide with the keys of other packages.
+func (ctx stdContext) Value(key interface{}) interface{} {
+	if key == ctxKey {
+		return ctx.c
+	}
+	if _, ok := key.(typedKey); ok {
+		if val, ok := ctx.values[key]; ok {
+			return val
+		}
+	}
+	return ctx.Context.Value(key)
 }
@@ -0,0 +1,288 @@
+package napnap
+
+// reference:
+// https://tools.ietf.org/html/rfc7239
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// Forwarded isn't trusted by default, because common proxies such as nginx append to X-Forwarded-For
+	// but pass the Forwarded header of the client through untouched.
+	defaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-Ip"}
+)
+
+// forwardedElement is a single element of the Forwarded header, which is added by a proxy.
+type forwardedElement struct {
+	forIP string
+	proto string
+	host  string
+}
+
+// trustedProxyNets returns the parsed NapNap.TrustedProxies.  The result is cached until the list is changed
+// and invalid entries are ignored.
+func (nap *NapNap) trustedProxyNets() []*net.IPNet {
+	nap.trustedProxiesMu.RLock()
+	cached := equalStrings(nap.trustedProxiesSource, nap.TrustedProxies)
+	result := nap.trustedProxyNetsCache
+	nap.trustedProxiesMu.RUnlock()
+	if cached {
+		return result
+	}
+
+	result = nil
+	for _, proxy := range nap.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			nap.Logger.Warn("napnap: invalid trusted proxy was ignored", "proxy", proxy)
+			continue
+		}
+		result = append(result, ipNet)
+	}
+
+	nap.trustedProxiesMu.Lock()
+	nap.trustedProxiesSource = append([]string(nil), nap.TrustedProxies...)
+	nap.trustedProxyNetsCache = result
+	nap.trustedProxiesMu.Unlock()
+	return result
+}
+
+// isTrustedProxy reports whether the ip belongs to one of the trusted proxies.
+func (nap *NapNap) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nap.trustedProxyNets() {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (nap *NapNap) remoteIPHeaders() []string {
+	if nap.RemoteIPHeaders != nil {
+		return nap.RemoteIPHeaders
+	}
+	return defaultRemoteIPHeaders
+}
+
+// trustsForwarded reports whether the Forwarded header was configured in NapNap.RemoteIPHeaders.
+func (nap *NapNap) trustsForwarded() bool {
+	for _, headerName := range nap.remoteIPHeaders() {
+		if http.CanonicalHeaderKey(headerName) == "Forwarded" {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the ip of the peer which connects to the server directly.
+func (c *Context) remoteIP() string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		return ""
+	}
+	return ip
+}
+
+// isFromTrustedProxy reports whether the request was sent by one of the trusted proxies.
+func (c *Context) isFromTrustedProxy() bool {
+	return c.NapNap.isTrustedProxy(net.ParseIP(c.remoteIP()))
+}
+
+// forwardedClient walks the hops of the header from right to left and returns the index of the rightmost
+// untrusted hop.  If all hops are trusted, the leftmost hop is returned.  It returns -1 if any hop is invalid.
+func (c *Context) forwardedClient(hops []string) int {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			return -1
+		}
+		if !c.NapNap.isTrustedProxy(ip) || i == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// forwarded returns the element of the Forwarded header which was added by the proxy closest to the client,
+// which is still trusted.
+func (c *Context) forwarded() (forwardedElement, bool) {
+	elements := parseForwarded(c.Request.Header)
+	if len(elements) == 0 {
+		return forwardedElement{}, false
+	}
+	hops := make([]string, len(elements))
+	for i, element := range elements {
+		hops[i] = element.forIP
+	}
+	index := c.forwardedClient(hops)
+	if index < 0 {
+		return forwardedElement{}, false
+	}
+	return elements[index], true
+}
+
+// trustedForwarded returns the element of the Forwarded header when the header is trusted.
+func (c *Context) trustedForwarded() (forwardedElement, bool) {
+	if !c.NapNap.trustsForwarded() {
+		return forwardedElement{}, false
+	}
+	return c.forwarded()
+}
+
+// ClientIP returns the real client IP.  The remote address is returned unless the request was sent by one of
+// `NapNap.TrustedProxies`.  For trusted proxies the headers of `NapNap.RemoteIPHeaders` are checked in order and
+// the rightmost hop which isn't a trusted proxy is returned, so clients can't spoof their IP by sending the headers.
+func (c *Context) ClientIP() string {
+	remoteIP := c.remoteIP()
+	if !c.NapNap.isTrustedProxy(net.ParseIP(remoteIP)) {
+		return remoteIP
+	}
+
+	for _, headerName := range c.NapNap.remoteIPHeaders() {
+		switch http.CanonicalHeaderKey(headerName) {
+		case "Forwarded":
+			if element, ok := c.forwarded(); ok {
+				return element.forIP
+			}
+		case "X-Forwarded-For":
+			hops := splitHeaderList(c.Request.Header.Values(headerName))
+			if index := c.forwardedClient(hops); index >= 0 {
+				return hops[index]
+			}
+		default:
+			value := strings.TrimSpace(c.Request.Header.Get(headerName))
+			if ip := net.ParseIP(value); ip != nil {
+				return value
+			}
+		}
+	}
+	return remoteIP
+}
+
+// RealProto returns the protocol the client used to connect to the first trusted proxy, such as http, https or wss.
+// It is the value of the Forwarded header (proto), if it is in NapNap.RemoteIPHeaders, or the X-Forwarded-Proto header.
+// If the request wasn't sent by a trusted proxy, the scheme of this connection is returned.
+func (c *Context) RealProto() string {
+	if c.isFromTrustedProxy() {
+		if element, ok := c.trustedForwarded(); ok && len(element.proto) > 0 {
+			return strings.ToLower(element.proto)
+		}
+		if proto := lastHeaderValue(c.Request.Header.Values("X-Forwarded-Proto")); len(proto) > 0 {
+			return strings.ToLower(proto)
+		}
+	}
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Scheme returns http or https which the client used.  It honours the same trust rules as ClientIP.
+func (c *Context) Scheme() string {
+	switch c.RealProto() {
+	case "https", "wss":
+		return "https"
+	default:
+		return "http"
+	}
+}
+
+// Host returns the host which the client requested.  It honours the same trust rules as ClientIP, so the Forwarded
+// header (host), if it is in NapNap.RemoteIPHeaders, or the X-Forwarded-Host header are used for trusted proxies.
+func (c *Context) Host() string {
+	if c.isFromTrustedProxy() {
+		if element, ok := c.trustedForwarded(); ok && len(element.host) > 0 {
+			return element.host
+		}
+		if host := lastHeaderValue(c.Request.Header.Values("X-Forwarded-Host")); len(host) > 0 {
+			return host
+		}
+	}
+	return c.Request.Host
+}
+
+// parseForwarded parses all Forwarded headers of the request into elements.
+func parseForwarded(header http.Header) []forwardedElement {
+	var elements []forwardedElement
+	for _, item := range splitHeaderList(header.Values("Forwarded")) {
+		var element forwardedElement
+		for _, pair := range strings.Split(item, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			switch strings.ToLower(strings.TrimSpace(kv[0])) {
+			case "for":
+				element.forIP = stripForwardedPort(value)
+			case "proto":
+				element.proto = value
+			case "host":
+				element.host = value
+			}
+		}
+		elements = append(elements, element)
+	}
+	return elements
+}
+
+// stripForwardedPort removes the port from the node of the Forwarded header, such as `[2001:db8::1]:4711` or `192.0.2.43:47011`.
+func stripForwardedPort(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.IndexByte(node, ']'); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if strings.Count(node, ":") == 1 {
+		return node[:strings.IndexByte(node, ':')]
+	}
+	return node
+}
+
+// splitHeaderList splits comma separated header values into a list of trimmed values.
+func splitHeaderList(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
+func lastHeaderValue(values []string) string {
+	list := splitHeaderList(values)
+	if len(list) == 0 {
+		return ""
+	}
+	return list[len(list)-1]
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
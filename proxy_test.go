@@ -0,0 +1,112 @@
+package napnap
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIPIgnoresHeadersFromUntrustedPeer(t *testing.T) {
+	c, _, _ := createTestContext()
+
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.RemoteAddr = "50.50.50.50:1234"
+	c.Request.Header.Set("X-Forwarded-For", "1.1.1.1")
+	c.Request.Header.Set("X-Real-Ip", "1.1.1.1")
+	c.Request.Header.Set("Forwarded", "for=1.1.1.1")
+
+	assert.Equal(t, "50.50.50.50", c.ClientIP())
+}
+
+func TestClientIPReturnsRightmostUntrustedHop(t *testing.T) {
+	c, _, nap := createTestContext()
+	nap.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	// the client spoofed 1.1.1.1 and the trusted proxies appended the real hops
+	c.Request.Header.Add("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+	c.Request.Header.Add("X-Forwarded-For", "192.168.1.1")
+	assert.Equal(t, "2.2.2.2", c.ClientIP())
+
+	// all hops are trusted
+	c.Request.Header.Set("X-Forwarded-For", "10.0.0.5, 192.168.1.1")
+	assert.Equal(t, "10.0.0.5", c.ClientIP())
+
+	// invalid hops are ignored and the next header is used
+	c.Request.Header.Set("X-Forwarded-For", "garbage")
+	assert.Equal(t, "10.0.0.1", c.ClientIP())
+}
+
+func TestClientIPWithForwardedHeader(t *testing.T) {
+	c, _, nap := createTestContext()
+	nap.TrustedProxies = []string{"10.0.0.0/8", "2001:db8::/32"}
+	nap.RemoteIPHeaders = []string{"Forwarded", "X-Forwarded-For"}
+
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Request.Header.Set("Forwarded", `for=1.1.1.1, for="[2001:db8:cafe::17]:4711";proto=http, for=192.0.2.43:47011;proto=https;host=example.com, for="[2001:db8::1]"`)
+	c.Request.Header.Set("X-Forwarded-For", "3.3.3.3")
+
+	assert.Equal(t, "192.0.2.43", c.ClientIP())
+	assert.Equal(t, "https", c.Scheme())
+	assert.Equal(t, "https", c.RealProto())
+	assert.Equal(t, "example.com", c.Host())
+}
+
+func TestClientIPIgnoresForwardedHeaderByDefault(t *testing.T) {
+	c, _, nap := createTestContext()
+	nap.TrustedProxies = []string{"10.0.0.1"}
+
+	c.Request, _ = http.NewRequest("GET", "http://napnap.com/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	// the client sent the Forwarded header and the proxy only appended to X-Forwarded-For
+	c.Request.Header.Set("Forwarded", "for=1.2.3.4;proto=https;host=evil.com")
+	c.Request.Header.Set("X-Forwarded-For", "1.2.3.4, 8.8.8.8")
+
+	assert.Equal(t, "8.8.8.8", c.ClientIP())
+	assert.Equal(t, "http", c.Scheme())
+	assert.Equal(t, "napnap.com", c.Host())
+}
+
+func TestClientIPWithCustomHeaderChain(t *testing.T) {
+	c, _, nap := createTestContext()
+	nap.TrustedProxies = []string{"173.245.48.0/20"}
+	nap.RemoteIPHeaders = []string{"CF-Connecting-IP", "X-Forwarded-For"}
+
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.RemoteAddr = "173.245.48.1:1234"
+	c.Request.Header.Set("CF-Connecting-IP", "4.4.4.4")
+	c.Request.Header.Set("X-Forwarded-For", "5.5.5.5")
+	assert.Equal(t, "4.4.4.4", c.ClientIP())
+}
+
+func TestContextSchemeAndHost(t *testing.T) {
+	c, _, nap := createTestContext()
+
+	c.Request, _ = http.NewRequest("GET", "http://napnap.com/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Request.Header.Set("X-Forwarded-Proto", "https")
+	c.Request.Header.Set("X-Forwarded-Host", "evil.com")
+
+	// the peer isn't trusted
+	assert.Equal(t, "http", c.Scheme())
+	assert.Equal(t, "napnap.com", c.Host())
+
+	c.Request.TLS = &tls.ConnectionState{}
+	assert.Equal(t, "https", c.Scheme())
+	c.Request.TLS = nil
+
+	nap.TrustedProxies = []string{"10.0.0.1"}
+	c, _, _ = createTestContext()
+	c.NapNap = nap
+	c.Request, _ = http.NewRequest("GET", "http://napnap.com/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Request.Header.Set("X-Forwarded-Proto", "WSS")
+	c.Request.Header.Set("X-Forwarded-Host", "api.napnap.com")
+	assert.Equal(t, "https", c.Scheme())
+	assert.Equal(t, "wss", c.RealProto())
+	assert.Equal(t, "api.napnap.com", c.Host())
+}
@@ -0,0 +1,266 @@
+package napnap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRendererRequired is returned by Render when no renderer was set.
+	ErrRendererRequired = errors.New("napnap: renderer is not set")
+	// ErrViewNotFound is returned by renderers when the view doesn't exist.
+	ErrViewNotFound = errors.New("napnap: view doesn't exist")
+)
+
+// Renderer renders the view with the data.  It must be safe for concurrent use.
+type Renderer interface {
+	Render(w io.Writer, name string, data interface{}) error
+}
+
+// ContentTyper can be implemented by renderers whose output isn't HTML.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// SetRenderer sets the default renderer which is used by Context.Render for views whose extensions weren't registered.
+func (nap *NapNap) SetRenderer(r Renderer) {
+	nap.renderer = r
+}
+
+// RegisterRenderer registers the renderer for the views with the extension, such as ".txt" or ".md".
+// Several engines can be used at the same time.
+func (nap *NapNap) RegisterRenderer(ext string, r Renderer) {
+	if nap.renderers == nil {
+		nap.renderers = make(map[string]Renderer)
+	}
+	nap.renderers[strings.ToLower(ext)] = r
+}
+
+// rendererFor returns the renderer which is registered for the extension of the view or the default renderer.
+func (nap *NapNap) rendererFor(name string) Renderer {
+	if r, ok := nap.renderers[strings.ToLower(path.Ext(name))]; ok {
+		return r
+	}
+	return nap.renderer
+}
+
+// RenderToBytes renders the view into memory, so it can be used for emails or other responses.
+func (nap *NapNap) RenderToBytes(name string, data interface{}) ([]byte, error) {
+	r := nap.rendererFor(name)
+	if r == nil {
+		return nil, ErrRendererRequired
+	}
+	var buf bytes.Buffer
+	if err := r.Render(&buf, name, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderToString renders the view into a string.
+func (nap *NapNap) RenderToString(name string, data interface{}) (string, error) {
+	b, err := nap.RenderToBytes(name, data)
+	return string(b), err
+}
+
+// isViewNotFound returns true when the renderer couldn't find the view.
+func isViewNotFound(err error) bool {
+	return errors.Is(err, ErrViewNotFound) || errors.Is(err, fs.ErrNotExist)
+}
+
+// contentTypeOf returns the content type of the output of the renderer.  Default value is html.
+func contentTypeOf(r Renderer) string {
+	if typer, ok := r.(ContentTyper); ok {
+		return typer.ContentType()
+	}
+	return "text/html; charset=utf-8"
+}
+
+// templateRenderer renders the templates of a html/template set by name.
+type templateRenderer struct {
+	t *template.Template
+}
+
+func (r templateRenderer) Render(w io.Writer, name string, data interface{}) error {
+	return r.t.ExecuteTemplate(w, name, data)
+}
+
+// HTMLEngine is the default renderer which renders html/template views.  Views are parsed once and
+// every view can use the layouts and partials of the shared directory, so views can fill the blocks of a layout.
+type HTMLEngine struct {
+	// FS is where the templates are loaded from, such as os.DirFS("templates") or an embed.FS
+	FS fs.FS
+	// ViewsDir is the directory of the views.  Views are named by their paths in the directory, such as "users/show.html".
+	// Default value is "views"
+	ViewsDir string
+	// SharedDir is the directory of the layouts and partials which are shared by all views.  Default value is "shares"
+	SharedDir string
+	// Extension is the extension of the template files.  Default value is ".html"
+	Extension string
+	// Layout is the shared template which is executed for all views.  The views fill its blocks with {{define}}.
+	// Default value is empty which means the view is executed.
+	Layout string
+	// Funcs are the functions which are available to all templates.
+	Funcs template.FuncMap
+	// Reload checks the files on every render and parses them again when they changed.  It is for development only.
+	Reload bool
+
+	mu          sync.RWMutex
+	loaded      bool
+	views       map[string]*template.Template
+	fingerprint string
+}
+
+// NewHTMLEngine returns a HTMLEngine which loads the templates from the file system.
+func NewHTMLEngine(fsys fs.FS) *HTMLEngine {
+	return &HTMLEngine{
+		FS:        fsys,
+		ViewsDir:  "views",
+		SharedDir: "shares",
+		Extension: ".html",
+	}
+}
+
+// Load parses all templates.  It is called by the first Render if it wasn't called before,
+// but calling it at startup reports template errors early.
+func (e *HTMLEngine) Load() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.load()
+}
+
+func (e *HTMLEngine) load() error {
+	shared, err := e.files(e.SharedDir)
+	if err != nil {
+		return err
+	}
+	views, err := e.files(e.ViewsDir)
+	if err != nil {
+		return err
+	}
+
+	root := template.New("").Funcs(e.Funcs)
+	for _, name := range shared {
+		if err = e.parse(root, e.SharedDir, name); err != nil {
+			return err
+		}
+	}
+
+	result := make(map[string]*template.Template, len(views))
+	for _, name := range views {
+		t, err := root.Clone()
+		if err != nil {
+			return err
+		}
+		if err = e.parse(t, e.ViewsDir, name); err != nil {
+			return err
+		}
+		result[name] = t
+	}
+
+	fingerprint, err := e.computeFingerprint()
+	if err != nil {
+		return err
+	}
+	e.views = result
+	e.fingerprint = fingerprint
+	e.loaded = true
+	return nil
+}
+
+func (e *HTMLEngine) parse(t *template.Template, dir, name string) error {
+	b, err := fs.ReadFile(e.FS, path.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	_, err = t.New(name).Parse(string(b))
+	return err
+}
+
+// files returns the template files in the directory by their relative paths.  A missing directory has no files.
+func (e *HTMLEngine) files(dir string) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(e.FS, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, e.Extension) {
+			return nil
+		}
+		names = append(names, strings.TrimPrefix(p, dir+"/"))
+		return nil
+	})
+	return names, err
+}
+
+// computeFingerprint describes the paths, sizes and modification times of all files, so changes can be detected.
+func (e *HTMLEngine) computeFingerprint() (string, error) {
+	var entries []string
+	err := fs.WalkDir(e.FS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, p+"|"+info.ModTime().Format(time.RFC3339Nano)+"|"+strconv.FormatInt(info.Size(), 10))
+		return nil
+	})
+	sort.Strings(entries)
+	return strings.Join(entries, "\n"), err
+}
+
+// Render executes the view.
+func (e *HTMLEngine) Render(w io.Writer, name string, data interface{}) error {
+	if err := e.ensureLoaded(); err != nil {
+		return err
+	}
+
+	e.mu.RLock()
+	t, ok := e.views[name]
+	e.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrViewNotFound, name)
+	}
+	if len(e.Layout) > 0 {
+		return t.ExecuteTemplate(w, e.Layout, data)
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+func (e *HTMLEngine) ensureLoaded() error {
+	e.mu.RLock()
+	loaded := e.loaded
+	e.mu.RUnlock()
+	if loaded && !e.Reload {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.loaded {
+		return e.load()
+	}
+	fingerprint, err := e.computeFingerprint()
+	if err != nil {
+		return err
+	}
+	if fingerprint != e.fingerprint {
+		return e.load()
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package napnap
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MarkdownRenderer renders Markdown files as HTML.  It supports headings, paragraphs, emphasis, links, inline code,
+// fenced code blocks, lists, blockquotes and horizontal rules; raw HTML is escaped.  The data is ignored and
+// every file is converted once.
+type MarkdownRenderer struct {
+	// FS is where the files are loaded from.
+	FS fs.FS
+	// Dir is the directory of the files.  Default value is "."
+	Dir string
+
+	cache sync.Map
+}
+
+// NewMarkdownRenderer returns a MarkdownRenderer which loads the files from the file system.
+func NewMarkdownRenderer(fsys fs.FS) *MarkdownRenderer {
+	return &MarkdownRenderer{
+		FS:  fsys,
+		Dir: ".",
+	}
+}
+
+// Render writes the HTML of the Markdown file.
+func (r *MarkdownRenderer) Render(w io.Writer, name string, data interface{}) error {
+	if cached, ok := r.cache.Load(name); ok {
+		_, err := w.Write(cached.([]byte))
+		return err
+	}
+	src, err := fs.ReadFile(r.FS, path.Join(r.Dir, name))
+	if err != nil {
+		return err
+	}
+	out := markdownToHTML(src)
+	r.cache.Store(name, out)
+	_, err = w.Write(out)
+	return err
+}
+
+var (
+	mdHeading     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	mdRule        = regexp.MustCompile(`^(\*\s*){3,}$|^(-\s*){3,}$|^(_\s*){3,}$`)
+	mdUnordered   = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	mdOrdered     = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+	mdLink        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdStrong      = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	mdEmphasis    = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	mdSafeSchemes = []string{"http:", "https:", "mailto:"}
+)
+
+// markdownToHTML converts the Markdown document to HTML.
+func markdownToHTML(src []byte) []byte {
+	var out bytes.Buffer
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+
+	var paragraph []string
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + markdownInline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case len(trimmed) == 0:
+			flushParagraph()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flushParagraph()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			if len(lang) > 0 {
+				out.WriteString(`<pre><code class="language-` + html.EscapeString(lang) + `">`)
+			} else {
+				out.WriteString("<pre><code>")
+			}
+			out.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			out.WriteString("</code></pre>\n")
+
+		case mdHeading.MatchString(trimmed):
+			flushParagraph()
+			m := mdHeading.FindStringSubmatch(trimmed)
+			level := strconv.Itoa(len(m[1]))
+			out.WriteString("<h" + level + ">" + markdownInline(m[2]) + "</h" + level + ">\n")
+
+		case mdRule.MatchString(trimmed):
+			flushParagraph()
+			out.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				l := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(l, " "))
+			}
+			i--
+			out.WriteString("<blockquote>\n")
+			out.Write(markdownToHTML([]byte(strings.Join(quote, "\n"))))
+			out.WriteString("</blockquote>\n")
+
+		case mdUnordered.MatchString(trimmed) || mdOrdered.MatchString(trimmed):
+			flushParagraph()
+			pattern, tag := mdUnordered, "ul"
+			if !mdUnordered.MatchString(trimmed) {
+				pattern, tag = mdOrdered, "ol"
+			}
+			out.WriteString("<" + tag + ">\n")
+			for ; i < len(lines); i++ {
+				m := pattern.FindStringSubmatch(strings.TrimSpace(lines[i]))
+				if m == nil {
+					break
+				}
+				item := m[1]
+				// indented lines continue the item
+				for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "  ") && len(strings.TrimSpace(lines[i+1])) > 0 {
+					i++
+					item += "\n" + strings.TrimSpace(lines[i])
+				}
+				out.WriteString("<li>" + markdownInline(item) + "</li>\n")
+			}
+			i--
+			out.WriteString("</" + tag + ">\n")
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flushParagraph()
+	return out.Bytes()
+}
+
+// markdownInline converts code spans, links and emphasis.  The text is escaped first, so raw HTML is never passed through.
+func markdownInline(text string) string {
+	var sb strings.Builder
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		// odd parts are inside code spans, unless the last backtick isn't closed
+		if i%2 == 1 && i < len(parts)-1 {
+			sb.WriteString("<code>" + html.EscapeString(part) + "</code>")
+			continue
+		}
+		if i%2 == 1 {
+			sb.WriteString("`")
+		}
+		s := html.EscapeString(part)
+		s = mdLink.ReplaceAllStringFunc(s, func(m string) string {
+			sub := mdLink.FindStringSubmatch(m)
+			return `<a href="` + safeMarkdownURL(sub[2]) + `">` + sub[1] + `</a>`
+		})
+		s = mdStrong.ReplaceAllString(s, "<strong>$1$2</strong>")
+		s = mdEmphasis.ReplaceAllString(s, "<em>$1$2</em>")
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+// safeMarkdownURL only allows relative urls and http, https and mailto schemes.
+func safeMarkdownURL(u string) string {
+	colon := strings.Index(u, ":")
+	if colon < 0 || strings.ContainsAny(u[:colon], "/?#") {
+		return u
+	}
+	lower := strings.ToLower(u)
+	for _, scheme := range mdSafeSchemes {
+		if strings.HasPrefix(lower, scheme) {
+			return u
+		}
+	}
+	return "#"
+}
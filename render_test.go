@@ -0,0 +1,227 @@
+package napnap
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTemplateFS() fstest.MapFS {
+	return fstest.MapFS{
+		"shares/layout.html":       {Data: []byte(`<title>{{block "title" .}}napnap{{end}}</title><main>{{block "content" .}}{{end}}</main>`)},
+		"shares/partials/nav.html": {Data: []byte(`<nav>{{upper .Name}}</nav>`)},
+		"views/index.html":         {Data: []byte(`{{template "layout.html" .}}{{define "content"}}{{template "partials/nav.html" .}}hi {{.Name}}{{end}}`)},
+		"views/users/show.html":    {Data: []byte(`{{template "layout.html" .}}{{define "title"}}user{{end}}{{define "content"}}{{.Name}}{{end}}`)},
+	}
+}
+
+func TestHTMLEngine(t *testing.T) {
+	engine := NewHTMLEngine(newTestTemplateFS())
+	engine.Funcs = template.FuncMap{"upper": strings.ToUpper}
+	assert.Nil(t, engine.Load())
+
+	var buf bytes.Buffer
+	assert.Nil(t, engine.Render(&buf, "index.html", map[string]string{"Name": "<jason>"}))
+	assert.Equal(t, "<title>napnap</title><main><nav>&lt;JASON&gt;</nav>hi &lt;jason&gt;</main>", buf.String())
+
+	// the blocks of one view don't leak into another
+	buf.Reset()
+	assert.Nil(t, engine.Render(&buf, "users/show.html", map[string]string{"Name": "jason"}))
+	assert.Equal(t, "<title>user</title><main>jason</main>", buf.String())
+
+	assert.Error(t, engine.Render(&buf, "missing.html", nil))
+}
+
+func TestHTMLEngineLoadError(t *testing.T) {
+	engine := NewHTMLEngine(fstest.MapFS{
+		"views/index.html": {Data: []byte(`{{if}}`)},
+	})
+	assert.Error(t, engine.Load())
+
+	// a missing shared directory isn't an error
+	engine = NewHTMLEngine(fstest.MapFS{
+		"views/index.html": {Data: []byte(`hi`)},
+	})
+	assert.Nil(t, engine.Load())
+}
+
+func TestHTMLEngineReload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"views/index.html": {Data: []byte(`v1`), ModTime: time.Unix(1, 0)},
+	}
+	engine := NewHTMLEngine(fsys)
+	engine.Reload = true
+
+	var buf bytes.Buffer
+	assert.Nil(t, engine.Render(&buf, "index.html", nil))
+	assert.Equal(t, "v1", buf.String())
+
+	fsys["views/index.html"] = &fstest.MapFile{Data: []byte(`v2`), ModTime: time.Unix(2, 0)}
+	buf.Reset()
+	assert.Nil(t, engine.Render(&buf, "index.html", nil))
+	assert.Equal(t, "v2", buf.String())
+}
+
+func TestContextRender(t *testing.T) {
+	nap := New()
+	nap.ErrorHandler = DefaultErrorHandler
+	nap.Get("/", func(c *Context) error {
+		return c.Render(201, "users/show.html", map[string]string{"Name": "jason"})
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+
+	engine := NewHTMLEngine(newTestTemplateFS())
+	engine.Funcs = template.FuncMap{"upper": strings.ToUpper}
+	nap.SetRenderer(engine)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "<title>user</title><main>jason</main>", w.Body.String())
+
+	// SetRender returns template errors instead of panicking
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "views"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "views", "index.html"), []byte(`{{if}}`), 0644))
+	assert.Error(t, nap.SetRender(dir))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "views", "index.html"), []byte(`hi`), 0644))
+	assert.Nil(t, nap.SetRender(dir))
+}
+
+func TestTextEngine(t *testing.T) {
+	engine := NewTextEngine(fstest.MapFS{
+		"emails/footer.txt":  {Data: []byte(`-- {{.Team}}`)},
+		"emails/welcome.txt": {Data: []byte("Hi {{.Name}},\n{{template \"emails/footer.txt\" .}}")},
+	})
+
+	var buf bytes.Buffer
+	assert.Nil(t, engine.Render(&buf, "emails/welcome.txt", map[string]string{"Name": "<jason>", "Team": "napnap"}))
+	assert.Equal(t, "Hi <jason>,\n-- napnap", buf.String())
+	assert.Error(t, engine.Render(&buf, "emails/missing.txt", nil))
+}
+
+func TestMarkdownToHTML(t *testing.T) {
+	src := "# Title\n\nSome *em* and **strong** with `a<b` and [link](https://napnap.dev) [bad](javascript:alert(1)).\nsecond line <script>\n\n- one\n- two\n\n1. first\n\n> quote\n\n---\n\n```go\nif a < b {}\n```\n"
+	expected := `<h1>Title</h1>
+<p>Some <em>em</em> and <strong>strong</strong> with <code>a&lt;b</code> and <a href="https://napnap.dev">link</a> <a href="#">bad</a>).
+second line &lt;script&gt;</p>
+<ul>
+<li>one</li>
+<li>two</li>
+</ul>
+<ol>
+<li>first</li>
+</ol>
+<blockquote>
+<p>quote</p>
+</blockquote>
+<hr>
+<pre><code class="language-go">if a &lt; b {}</code></pre>
+`
+	assert.Equal(t, expected, string(markdownToHTML([]byte(src))))
+}
+
+func TestContextRenderByExtension(t *testing.T) {
+	nap := New()
+	nap.SetRenderer(NewHTMLEngine(fstest.MapFS{"views/index.html": {Data: []byte(`<b>{{.}}</b>`)}}))
+	nap.RegisterRenderer(".txt", NewTextEngine(fstest.MapFS{"welcome.txt": {Data: []byte(`<b>{{.}}</b>`)}}))
+	nap.RegisterRenderer(".md", NewMarkdownRenderer(fstest.MapFS{"docs/intro.md": {Data: []byte(`# Intro`)}}))
+
+	tests := []struct {
+		view        string
+		contentType string
+		body        string
+	}{
+		{"index.html", "text/html; charset=utf-8", "<b>&lt;jason&gt;</b>"},
+		{"welcome.txt", "text/plain; charset=utf-8", "<b><jason></b>"},
+		{"docs/intro.md", "text/html; charset=utf-8", "<h1>Intro</h1>\n"},
+	}
+	for _, test := range tests {
+		c, w, _ := createTestContext()
+		c.NapNap = nap
+		assert.Nil(t, c.Render(200, test.view, "<jason>"))
+		assert.Equal(t, test.contentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, test.body, w.Body.String())
+	}
+}
+
+func TestContextRenderFailureDoesNotCommit(t *testing.T) {
+	nap := New()
+	nap.ErrorHandler = DefaultErrorHandler
+	nap.SetRenderer(NewHTMLEngine(fstest.MapFS{"views/broken.html": {Data: []byte(`<p>{{.Missing.Field}}</p>`)}}))
+	nap.Get("/", func(c *Context) error {
+		return c.Render(200, "broken.html", struct{ Name string }{})
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, `{"code":500,"message":"Internal Server Error"}`, w.Body.String())
+}
+
+func TestRenderToString(t *testing.T) {
+	nap := New()
+	_, err := nap.RenderToString("index.html", nil)
+	assert.Equal(t, ErrRendererRequired, err)
+
+	nap.SetRenderer(NewHTMLEngine(fstest.MapFS{"views/index.html": {Data: []byte(`hi {{.}}`)}}))
+	s, err := nap.RenderToString("index.html", "jason")
+	assert.Nil(t, err)
+	assert.Equal(t, "hi jason", s)
+
+	_, err = nap.RenderToBytes("missing.html", nil)
+	assert.True(t, errors.Is(err, ErrViewNotFound))
+}
+
+func TestErrorPages(t *testing.T) {
+	nap := New()
+	nap.ErrorHandler = DefaultErrorHandler
+	nap.NotFoundHandler = func(c *Context) error {
+		return ErrNotFound
+	}
+	nap.SetRenderer(NewHTMLEngine(fstest.MapFS{
+		"shares/layout.html":      {Data: []byte(`<body>{{block "content" .}}{{end}}</body>`)},
+		"views/errors/404.html":   {Data: []byte(`{{template "layout.html" .}}{{define "content"}}missing {{.RequestID}}{{end}}`)},
+		"views/errors/error.html": {Data: []byte(`{{template "layout.html" .}}{{define "content"}}{{.Code}} {{.Message}}{{end}}`)},
+	}))
+	nap.Get("/conflict", func(c *Context) error {
+		return NewHTTPError(http.StatusConflict, "")
+	})
+
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "<body>missing </body>", w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/conflict", nil)
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, "<body>409 Conflict</body>", w.Body.String())
+
+	// api clients still get json
+	req, _ = http.NewRequest("GET", "/missing", nil)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, `{"code":404,"message":"Not Found"}`, w.Body.String())
+}
@@ -0,0 +1,81 @@
+package napnap
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// TextEngine renders text/template views, such as plain-text emails.  Unlike HTMLEngine, the output isn't escaped.
+// All templates in the directory are parsed once into one set, so they can include each other by their paths.
+type TextEngine struct {
+	// FS is where the templates are loaded from.
+	FS fs.FS
+	// Dir is the directory of the templates.  Templates are named by their paths in the directory, such as "emails/welcome.txt".
+	// Default value is "."
+	Dir string
+	// Extension is the extension of the template files.  Default value is ".txt"
+	Extension string
+	// Funcs are the functions which are available to all templates.
+	Funcs template.FuncMap
+
+	once sync.Once
+	t    *template.Template
+	err  error
+}
+
+// NewTextEngine returns a TextEngine which loads the templates from the file system.
+func NewTextEngine(fsys fs.FS) *TextEngine {
+	return &TextEngine{
+		FS:        fsys,
+		Dir:       ".",
+		Extension: ".txt",
+	}
+}
+
+// Load parses all templates.  It is called by the first Render if it wasn't called before.
+func (e *TextEngine) Load() error {
+	e.once.Do(func() {
+		e.t, e.err = e.load()
+	})
+	return e.err
+}
+
+func (e *TextEngine) load() (*template.Template, error) {
+	root := template.New("").Funcs(e.Funcs)
+	err := fs.WalkDir(e.FS, e.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, e.Extension) {
+			return err
+		}
+		b, err := fs.ReadFile(e.FS, p)
+		if err != nil {
+			return err
+		}
+		name := p
+		if e.Dir != "." {
+			name = strings.TrimPrefix(p, e.Dir+"/")
+		}
+		_, err = root.New(name).Parse(string(b))
+		return err
+	})
+	return root, err
+}
+
+// Render executes the template.
+func (e *TextEngine) Render(w io.Writer, name string, data interface{}) error {
+	if err := e.Load(); err != nil {
+		return err
+	}
+	if e.t.Lookup(name) == nil {
+		return fmt.Errorf("%w: %s", ErrViewNotFound, name)
+	}
+	return e.t.ExecuteTemplate(w, name, data)
+}
+
+// ContentType returns plain text.
+func (e *TextEngine) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
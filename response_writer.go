@@ -2,41 +2,76 @@ package napnap
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"time"
 )
 
 const (
-	noWritten     = -1
 	defaultStatus = 200
 )
 
 // ResponseWriter wraps the original http.ResponseWriter
 type ResponseWriter interface {
 	http.ResponseWriter
+	// ContentLength returns the number of bytes of the body which were written.
 	ContentLength() int
+	// BytesWritten returns the number of bytes of the body which were written to the client.
+	BytesWritten() int64
+	// Status returns the status code of the response.
 	Status() int
+	// Written returns true when the status and the headers were sent to the client.
+	Written() bool
+	// HeaderWrittenAt returns when the status and the headers were sent.  It is zero if they weren't sent yet.
+	HeaderWrittenAt() time.Time
+	// FirstByteAt returns when the first byte of the body was written.  It is zero if no byte was written yet.
+	FirstByteAt() time.Time
 	reset(writer http.ResponseWriter) ResponseWriter
 }
 
 type responseWriter struct {
 	http.ResponseWriter
-	committed     bool
-	status        int
-	contentLength int
+	committed       bool
+	status          int
+	bytesWritten    int64
+	headerWrittenAt time.Time
+	firstByteAt     time.Time
+	// variants are the wrappers which expose the optional interfaces of the underlying writer.
+	variants [8]ResponseWriter
 }
 
 // NewResponseWriter returns a ResponseWriter which wraps the writer
 func NewResponseWriter() ResponseWriter {
 	return &responseWriter{
-		status:        defaultStatus,
-		contentLength: noWritten,
+		status: defaultStatus,
 	}
 }
 
-// ContentLength returns size of content length
+// ContentLength returns the number of bytes of the body which were written
 func (rw *responseWriter) ContentLength() int {
-	return rw.contentLength
+	return int(rw.bytesWritten)
+}
+
+// BytesWritten returns the number of bytes of the body which were written
+func (rw *responseWriter) BytesWritten() int64 {
+	return rw.bytesWritten
+}
+
+// Written returns true when the status and the headers were sent
+func (rw *responseWriter) Written() bool {
+	return rw.committed
+}
+
+// HeaderWrittenAt returns when the status and the headers were sent
+func (rw *responseWriter) HeaderWrittenAt() time.Time {
+	return rw.headerWrittenAt
+}
+
+// FirstByteAt returns when the first byte of the body was written
+func (rw *responseWriter) FirstByteAt() time.Time {
+	return rw.firstByteAt
 }
 
 // Status returns http status code
@@ -50,13 +85,13 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 		rw.WriteHeader(http.StatusOK)
 	}
 	n, err := rw.ResponseWriter.Write(b)
-	rw.contentLength += n
+	rw.countBytes(int64(n))
 	return n, err
 }
 
 func (rw *responseWriter) WriteHeader(statusCode int) {
 	if rw.committed {
-		_logger.debug("Headers were already written.")
+		// the headers were already written
 		return
 	}
 
@@ -64,19 +99,161 @@ func (rw *responseWriter) WriteHeader(statusCode int) {
 	rw.status = statusCode
 	rw.ResponseWriter.WriteHeader(statusCode)
 	rw.committed = true
+	rw.headerWrittenAt = time.Now()
+}
+
+func (rw *responseWriter) countBytes(n int64) {
+	if n > 0 && rw.firstByteAt.IsZero() {
+		rw.firstByteAt = time.Now()
+	}
+	rw.bytesWritten += n
 }
 
 // Hijack implements the http.Hijacker interface to allow a HTTP handler to
-// take over the connection.
+// take over the connection.  An error is returned if the underlying writer can't be hijacked.
 // See https://golang.org/pkg/net/http/#Hijacker
 func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return rw.ResponseWriter.(http.Hijacker).Hijack()
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("napnap: hijack: %w", http.ErrNotSupported)
+	}
+	return hijacker.Hijack()
 }
 
+// Unwrap returns the underlying writer, so http.ResponseController can reach it.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+const (
+	supportFlusher = 1 << iota
+	supportPusher
+	supportReaderFrom
+)
+
+// reset returns a writer which only exposes http.Flusher, http.Pusher and io.ReaderFrom
+// when the underlying writer supports them.
 func (rw *responseWriter) reset(writer http.ResponseWriter) ResponseWriter {
 	rw.ResponseWriter = writer
-	rw.contentLength = noWritten
+	rw.bytesWritten = 0
 	rw.status = defaultStatus
 	rw.committed = false
-	return rw
+	rw.headerWrittenAt = time.Time{}
+	rw.firstByteAt = time.Time{}
+
+	var i int
+	if _, ok := writer.(http.Flusher); ok {
+		i |= supportFlusher
+	}
+	if _, ok := writer.(http.Pusher); ok {
+		i |= supportPusher
+	}
+	if _, ok := writer.(io.ReaderFrom); ok {
+		i |= supportReaderFrom
+	}
+	if i == 0 {
+		return rw
+	}
+	if rw.variants[i] == nil {
+		rw.variants[i] = rw.newVariant(i)
+	}
+	return rw.variants[i]
+}
+
+func (rw *responseWriter) newVariant(i int) ResponseWriter {
+	switch i {
+	case supportFlusher:
+		return struct {
+			*responseWriter
+			flusher
+		}{rw, flusher{rw}}
+	case supportPusher:
+		return struct {
+			*responseWriter
+			pusher
+		}{rw, pusher{rw}}
+	case supportReaderFrom:
+		return struct {
+			*responseWriter
+			readerFrom
+		}{rw, readerFrom{rw}}
+	case supportFlusher | supportPusher:
+		return struct {
+			*responseWriter
+			flusher
+			pusher
+		}{rw, flusher{rw}, pusher{rw}}
+	case supportFlusher | supportReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			readerFrom
+		}{rw, flusher{rw}, readerFrom{rw}}
+	case supportPusher | supportReaderFrom:
+		return struct {
+			*responseWriter
+			pusher
+			readerFrom
+		}{rw, pusher{rw}, readerFrom{rw}}
+	default:
+		return struct {
+			*responseWriter
+			flusher
+			pusher
+			readerFrom
+		}{rw, flusher{rw}, pusher{rw}, readerFrom{rw}}
+	}
+}
+
+type flusher struct {
+	rw *responseWriter
+}
+
+// Flush implements the http.Flusher interface to allow a HTTP handler to flush
+// buffered data to the client.
+func (f flusher) Flush() {
+	if !f.rw.committed {
+		f.rw.WriteHeader(http.StatusOK)
+	}
+	f.rw.ResponseWriter.(http.Flusher).Flush()
+}
+
+type pusher struct {
+	rw *responseWriter
+}
+
+// Push implements the http.Pusher interface for HTTP/2 server push.
+func (p pusher) Push(target string, opts *http.PushOptions) error {
+	return p.rw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+type readerFrom struct {
+	rw *responseWriter
+}
+
+// ReadFrom implements the io.ReaderFrom interface, so io.Copy can use sendfile.
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	if !r.rw.committed {
+		r.rw.WriteHeader(http.StatusOK)
+	}
+	n, err := r.rw.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	r.rw.countBytes(n)
+	return n, err
+}
+
+// detachedWriter is used by contexts which must not write the response, such as copies and released contexts.
+type detachedWriter struct {
+	reason string
+}
+
+func (w detachedWriter) Header() http.Header {
+	panic("napnap: " + w.reason)
+}
+
+func (w detachedWriter) Write([]byte) (int, error) {
+	panic("napnap: " + w.reason)
+}
+
+func (w detachedWriter) WriteHeader(int) {
+	panic("napnap: " + w.reason)
 }
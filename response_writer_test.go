@@ -0,0 +1,101 @@
+package napnap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// plainWriter only implements http.ResponseWriter
+type plainWriter struct {
+	header http.Header
+	body   strings.Builder
+}
+
+func (w *plainWriter) Header() http.Header         { return w.header }
+func (w *plainWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *plainWriter) WriteHeader(int)             {}
+
+// fullWriter implements all optional interfaces
+type fullWriter struct {
+	*httptest.ResponseRecorder
+	pushed   string
+	readFrom bool
+}
+
+func (w *fullWriter) Push(target string, opts *http.PushOptions) error {
+	w.pushed = target
+	return nil
+}
+
+func (w *fullWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder, r)
+}
+
+func (w *fullWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijacked")
+}
+
+func TestResponseWriterOptionalInterfaces(t *testing.T) {
+	rw := NewResponseWriter().reset(&plainWriter{header: http.Header{}})
+	_, isFlusher := rw.(http.Flusher)
+	_, isPusher := rw.(http.Pusher)
+	_, isReaderFrom := rw.(io.ReaderFrom)
+	assert.False(t, isFlusher)
+	assert.False(t, isPusher)
+	assert.False(t, isReaderFrom)
+	_, _, err := rw.(http.Hijacker).Hijack()
+	assert.True(t, errors.Is(err, http.ErrNotSupported))
+
+	underlying := &fullWriter{ResponseRecorder: httptest.NewRecorder()}
+	rw = NewResponseWriter().reset(underlying)
+	assert.Nil(t, rw.(http.Pusher).Push("/app.js", nil))
+	assert.Equal(t, "/app.js", underlying.pushed)
+
+	n, err := rw.(io.ReaderFrom).ReadFrom(strings.NewReader("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.True(t, underlying.readFrom)
+	assert.Equal(t, 200, rw.Status())
+
+	rw.(http.Flusher).Flush()
+	assert.True(t, underlying.Flushed)
+	_, _, err = rw.(http.Hijacker).Hijack()
+	assert.EqualError(t, err, "hijacked")
+
+	// http.ResponseController reaches the original writer
+	assert.Nil(t, http.NewResponseController(rw).Flush())
+	assert.Equal(t, underlying, rw.(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+}
+
+func TestResponseWriterAccounting(t *testing.T) {
+	c, _, _ := createTestContext()
+	assert.False(t, c.Writer.Written())
+	assert.Equal(t, 0, c.Writer.ContentLength())
+	assert.True(t, c.Writer.HeaderWrittenAt().IsZero())
+
+	c.SetStatus(201)
+	assert.True(t, c.Writer.Written())
+	assert.False(t, c.Writer.HeaderWrittenAt().IsZero())
+	assert.True(t, c.Writer.FirstByteAt().IsZero())
+
+	_, _ = c.Writer.Write([]byte("hello"))
+	_, _ = c.Writer.Write([]byte(" world"))
+	assert.Equal(t, 11, c.Writer.ContentLength())
+	assert.Equal(t, int64(11), c.Writer.BytesWritten())
+	assert.Equal(t, 201, c.Writer.Status())
+	assert.False(t, c.Writer.FirstByteAt().Before(c.Writer.HeaderWrittenAt()))
+
+	c.Writer = c.Writer.reset(httptest.NewRecorder())
+	assert.False(t, c.Writer.Written())
+	assert.Equal(t, int64(0), c.Writer.BytesWritten())
+	assert.True(t, c.Writer.FirstByteAt().IsZero())
+}
@@ -33,6 +33,8 @@ type methodHandler struct {
 	post    HandlerFunc
 	put     HandlerFunc
 	trace   HandlerFunc
+	// patterns are the paths of the routes by method, because routes with different parameter names can share a node
+	patterns map[string]string
 }
 
 const (
@@ -56,12 +58,6 @@ const (
 	TRACE = "TRACE"
 )
 
-var (
-	notFoundHandler = func(c *Context) {
-		_logger.debug("NotFound")
-	}
-)
-
 const (
 	skind kind = iota
 	pkind
@@ -103,8 +99,8 @@ func (r *router) Invoke(c *Context, next HandlerFunc) {
 		err = h(c)
 	}
 
-	if err != nil && r.nap.ErrorHandler != nil {
-		r.nap.ErrorHandler(c, err)
+	if err != nil {
+		c.handleError(err)
 	}
 }
 
@@ -156,21 +152,24 @@ func (r *router) Head(path string, handler HandlerFunc) {
 
 // Add function which adding path and handler to router
 func (r *router) Add(method string, path string, handler HandlerFunc) {
-	_logger.debug("===Add")
+	debug := r.nap.debugEnabled()
 	if len(path) == 0 {
 		panic("router: path couldn't be empty")
 	}
 	if path[0] != '/' {
 		panic("router: path was invalid")
 	}
+	pattern := path
 	if len(path) > 1 {
 		path = path[1:]
 	}
-	_logger.debug("path:" + path)
+	if debug {
+		r.nap.Logger.Debug("router: add", "method", method, "path", path)
+	}
 
 	currentNode := r.tree.rootNode
 	if path == "/" {
-		currentNode.addHandler(method, handler)
+		currentNode.addHandler(method, pattern, handler)
 		return
 	}
 
@@ -188,7 +187,9 @@ func (r *router) Add(method string, path string, handler HandlerFunc) {
 		if firstSymbol == ':' {
 			// this is parameter node
 			pName := element[1:]
-			_logger.debug("parameter_node_pname:" + pName)
+			if debug {
+				r.nap.Logger.Debug("router: parameter node", "name", pName)
+			}
 			childNode = currentNode.findChildByKind(pkind)
 			if childNode == nil {
 				childNode = newNode(pName, pkind)
@@ -204,7 +205,9 @@ func (r *router) Add(method string, path string, handler HandlerFunc) {
 
 			if isFound == false {
 				childNode.pNames = append(childNode.pNames, pName)
-				_logger.debug("add_parameter_name:" + pName)
+				if debug {
+					r.nap.Logger.Debug("router: add parameter name", "name", pName)
+				}
 			}
 
 			pathParams = append(pathParams, pName)
@@ -212,7 +215,9 @@ func (r *router) Add(method string, path string, handler HandlerFunc) {
 		} else if firstSymbol == '*' {
 			// this is match any node.  We should allow one match any node only.
 			pName := element[1:]
-			_logger.debug("match_node_pname:" + pName)
+			if debug {
+				r.nap.Logger.Debug("router: match any node", "name", pName)
+			}
 			childNode = currentNode.findChildByKind(akind)
 			if childNode == nil {
 				childNode = newNode(pName, akind)
@@ -234,7 +239,7 @@ func (r *router) Add(method string, path string, handler HandlerFunc) {
 		// last node in the path
 		if count == index+1 {
 			childNode.params = pathParams
-			childNode.addHandler(method, handler)
+			childNode.addHandler(method, pattern, handler)
 		}
 
 		currentNode = childNode
@@ -244,16 +249,21 @@ func (r *router) Add(method string, path string, handler HandlerFunc) {
 
 // Find returns http handler for specific path
 func (r *router) Find(method string, path string, c *Context) HandlerFunc {
-	_logger.debug("===Find")
-	_logger.debug("method:" + method)
-	_logger.debug("path:" + path)
+	debug := r.nap.debugEnabled()
+	if debug {
+		r.nap.Logger.Debug("router: find", "method", method, "path", path)
+	}
 	if path[0] == '/' && len(path) > 1 {
 		path = path[1:]
 	}
 
 	currentNode := r.tree.rootNode
 	if path == "/" {
-		return currentNode.findHandler(method)
+		h := currentNode.findHandler(method)
+		if h != nil {
+			c.routePattern = currentNode.handler.patterns[method]
+		}
+		return h
 	}
 
 	pathArray := strings.Split(path, "/")
@@ -271,7 +281,9 @@ func (r *router) Find(method string, path string, c *Context) HandlerFunc {
 			childNode = currentNode.findChildByKind(pkind)
 
 			if childNode != nil {
-				_logger.debugf("parameter node: %s", element)
+				if debug {
+					r.nap.Logger.Debug("router: parameter node", "element", element)
+				}
 				var newParams []Param
 				for _, pName := range childNode.pNames {
 					param := Param{Key: pName, Value: element}
@@ -287,17 +299,16 @@ func (r *router) Find(method string, path string, c *Context) HandlerFunc {
 			childNode = currentNode.findChildByKind(akind)
 
 			if childNode != nil {
-				_logger.debugf("match node: %s", element)
+				if debug {
+					r.nap.Logger.Debug("router: match any node", "element", element)
+				}
 				start := 0
 				for i := 0; i < index; i++ {
 					start += 1 + len(pathArray[i])
 				}
-				_logger.debugf("start: %d", start)
-				_logger.debugf("pname count: %d", len(childNode.pNames))
 				var newParams []Param
 				for _, pName := range childNode.pNames {
 					val := path[start:]
-					_logger.debugf("val: %s", val)
 					param := Param{Key: pName, Value: val}
 					newParams = append(newParams, param)
 				}
@@ -318,23 +329,27 @@ func (r *router) Find(method string, path string, c *Context) HandlerFunc {
 			myHandler := childNode.findHandler(method)
 			if myHandler == nil {
 				//return notFoundHandler
-				_logger.debug("handler was not found")
+				if debug {
+					r.nap.Logger.Debug("router: handler was not found", "method", method)
+				}
 				return nil
 			}
 
 			paramsNum = 0
 			//println("params_count:", len(pathParams))
-			_logger.debug("lastNode_params_count:", len(childNode.params))
 			for _, validParam := range childNode.params {
 				for _, p := range pathParams[paramsNum] {
 					if validParam == p.Key {
-						_logger.debug("matched: " + validParam + "," + p.Value)
+						if debug {
+							r.nap.Logger.Debug("router: matched parameter", "name", validParam, "value", p.Value)
+						}
 						c.params = append(c.params, p)
 					}
 				}
 				paramsNum++
 			}
 
+			c.routePattern = childNode.handler.patterns[method]
 			return myHandler
 		}
 
@@ -378,7 +393,7 @@ func (n *node) findChildByKind(t kind) *node {
 	return nil
 }
 
-func (n *node) addHandler(method string, h HandlerFunc) {
+func (n *node) addHandler(method string, pattern string, h HandlerFunc) {
 	switch method {
 	case GET:
 		n.handler.get = h
@@ -401,6 +416,10 @@ func (n *node) addHandler(method string, h HandlerFunc) {
 	default:
 		panic("method was invalid")
 	}
+	if n.handler.patterns == nil {
+		n.handler.patterns = make(map[string]string)
+	}
+	n.handler.patterns[method] = pattern
 }
 
 func (n *node) findHandler(method string) HandlerFunc {
@@ -2,6 +2,7 @@ package napnap
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -91,3 +92,65 @@ func TestRouterMatchAnyRoute(t *testing.T) {
 	assert.Equal(t, "aabbc", helo)
 	assert.Equal(t, 200, w.Code)
 }
+
+func TestRouterRoutePattern(t *testing.T) {
+	var pattern string
+	nap := New()
+	nap.Get("/users/:id/files/*path", func(c *Context) error {
+		pattern = c.RoutePattern()
+		return nil
+	})
+	nap.Get("/", func(c *Context) error {
+		pattern = c.RoutePattern()
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "/users/5/files/a/b.txt", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "/users/:id/files/*path", pattern)
+
+	req, _ = http.NewRequest("GET", "/", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "/", pattern)
+
+	// routes with different parameter names share a node
+	nap.Get("/orders/:id", func(c *Context) error {
+		pattern = c.RoutePattern()
+		return nil
+	})
+	nap.Put("/orders/:uid", func(c *Context) error {
+		pattern = c.RoutePattern()
+		return nil
+	})
+	req, _ = http.NewRequest("GET", "/orders/5", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "/orders/:id", pattern)
+	req, _ = http.NewRequest("PUT", "/orders/5", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "/orders/:uid", pattern)
+
+	// unmatched routes have no pattern
+	c := NewContext(nap, nil, NewResponseWriter())
+	assert.Nil(t, nap.router.Find(GET, "/missing", c))
+	assert.Empty(t, c.RoutePattern())
+}
+
+func TestRouterUnmatchedRoute(t *testing.T) {
+	nap := New()
+	nap.ErrorHandler = DefaultErrorHandler
+
+	// unmatched routes aren't answered unless NotFoundHandler is set
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	nap.NotFoundHandler = func(c *Context) error {
+		return ErrNotFound
+	}
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"code":404,"message":"Not Found"}`, w.Body.String())
+}
@@ -1,7 +1,10 @@
 package napnap
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -20,6 +23,12 @@ type Config struct {
 type Server struct {
 	*http.Server
 	Config *Config
+
+	hooksMu        sync.Mutex
+	startHooks     []func(ctx context.Context) error
+	listeningHooks []func(addr net.Addr)
+	shutdownHooks  []func(ctx context.Context) error
+	stoppedHooks   []func()
 }
 
 // NewHTTPEngine ...
@@ -42,3 +51,93 @@ func NewHTTPEngineWithConfig(c *Config) *Server {
 	s.WriteTimeout = c.WriteTimeout
 	return s
 }
+
+// OnStart registers a function which is called before the server starts listening, after the OnStart functions of NapNap.
+// The Run methods return the error without listening when a function fails.
+func (s *Server) OnStart(fn func(ctx context.Context) error) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.startHooks = append(s.startHooks, fn)
+}
+
+// OnListening registers a function which is called with the bound address when the server starts listening.
+func (s *Server) OnListening(fn func(addr net.Addr)) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.listeningHooks = append(s.listeningHooks, fn)
+}
+
+// OnShutdown registers a function which is called by NapNap.Shutdown before the server is drained, after the OnShutdown
+// functions of NapNap.
+func (s *Server) OnShutdown(fn func(ctx context.Context) error) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.shutdownHooks = append(s.shutdownHooks, fn)
+}
+
+// OnStopped registers a function which is called after NapNap.Shutdown drained the server.
+func (s *Server) OnStopped(fn func()) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.stoppedHooks = append(s.stoppedHooks, fn)
+}
+
+// start calls the OnStart functions of the server.  It is safe to call on the servers which napnap creates itself.
+func (s *Server) start() error {
+	if s == nil {
+		return nil
+	}
+	s.hooksMu.Lock()
+	hooks := append([]func(ctx context.Context) error(nil), s.startHooks...)
+	s.hooksMu.Unlock()
+
+	for _, hook := range hooks {
+		if err := hook(context.Background()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) listening(addr net.Addr) {
+	if s == nil {
+		return
+	}
+	s.hooksMu.Lock()
+	hooks := append(([]func(addr net.Addr))(nil), s.listeningHooks...)
+	s.hooksMu.Unlock()
+
+	for _, hook := range hooks {
+		hook(addr)
+	}
+}
+
+func (s *Server) shutdown(ctx context.Context) []error {
+	if s == nil {
+		return nil
+	}
+	s.hooksMu.Lock()
+	hooks := append([]func(ctx context.Context) error(nil), s.shutdownHooks...)
+	s.hooksMu.Unlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (s *Server) stopped() {
+	if s == nil {
+		return
+	}
+	s.hooksMu.Lock()
+	hooks := append(([]func())(nil), s.stoppedHooks...)
+	s.hooksMu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
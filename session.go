@@ -0,0 +1,526 @@
+package napnap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSessionCookieName = "napnap_session"
+	defaultSessionTTL        = 24 * time.Hour
+	flashesKey               = "_flashes"
+)
+
+var (
+	// ErrSessionNotFound is returned by SessionStore when the session doesn't exist or has expired.
+	ErrSessionNotFound = errors.New("napnap: session was not found")
+)
+
+func init() {
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+}
+
+// SessionStore persists the values of sessions.  Values are shared between goroutines, so stores must not modify them.
+type SessionStore interface {
+	// Load returns the values of the session.  ErrSessionNotFound is returned if the session doesn't exist or has expired.
+	Load(ctx context.Context, id string) (map[string]interface{}, error)
+	// Save stores the values of the session which expire after the ttl.
+	Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error
+	// Delete removes the session.
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionOptions configures the session middleware.
+type SessionOptions struct {
+	// CookieName is the name of the session cookie.  Default value is "napnap_session"
+	CookieName string
+	// TTL is how long a session lives after it was saved last time.  Default value is 24 hours
+	TTL time.Duration
+	// Cookie is the attributes of the session cookie.  Max-Age is the TTL if it is not set.
+	Cookie CookieOptions
+}
+
+// SessionMiddleware provides server-side sessions via Context.Session().
+type SessionMiddleware struct {
+	store SessionStore
+	opts  SessionOptions
+}
+
+// NewSessionMiddleware returns a session middleware which stores the sessions in the store.
+func NewSessionMiddleware(store SessionStore, opts SessionOptions) *SessionMiddleware {
+	if len(opts.CookieName) == 0 {
+		opts.CookieName = defaultSessionCookieName
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultSessionTTL
+	}
+	if opts.Cookie.MaxAge == 0 && opts.Cookie.Expires.IsZero() {
+		opts.Cookie.MaxAge = int(opts.TTL / time.Second)
+	}
+	return &SessionMiddleware{
+		store: store,
+		opts:  opts,
+	}
+}
+
+// Invoke function is a middleware entry
+func (m *SessionMiddleware) Invoke(c *Context, next HandlerFunc) {
+	s := &Session{
+		m: m,
+		c: c,
+	}
+	if cookie, err := c.Request.Cookie(m.opts.CookieName); err == nil && isValidSessionID(cookie.Value) {
+		s.id = cookie.Value
+	}
+	c.session = s
+
+	_ = next(c)
+
+	if err := s.Save(); err != nil {
+		c.Logger().Warn("napnap: failed to save session", "error", err)
+	}
+}
+
+// Session returns the session of the request.  It panics if the session middleware isn't registered.
+func (c *Context) Session() *Session {
+	if c.session == nil {
+		panic("napnap: session middleware is not registered")
+	}
+	return c.session
+}
+
+// Session holds the values of a client between requests.  The values are loaded lazily when they are accessed first time
+// and saved to the store after the request only when they were changed.
+// Session isn't safe for concurrent use.
+type Session struct {
+	m         *SessionMiddleware
+	c         *Context
+	id        string
+	values    map[string]interface{}
+	loaded    bool
+	loadErr   error
+	dirty     bool
+	destroyed bool
+}
+
+// ID returns the session id.  It is empty until the session is saved first time.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Load loads the values of the session from the store.  It is called automatically when the session is accessed,
+// so it is only needed when the handler wants to know the store error.
+func (s *Session) Load() error {
+	if s.loaded {
+		return s.loadErr
+	}
+	s.loaded = true
+	s.values = make(map[string]interface{})
+	if len(s.id) == 0 {
+		return nil
+	}
+
+	values, err := s.m.store.Load(s.c.StdContext(), s.id)
+	if err == ErrSessionNotFound {
+		// the session has expired, so a new id is required to prevent fixation
+		s.id = ""
+		return nil
+	}
+	if err != nil {
+		s.loadErr = err
+		s.c.Logger().Warn("napnap: failed to load session", "error", err)
+		return err
+	}
+	for k, v := range values {
+		s.values[k] = v
+	}
+	return nil
+}
+
+// Get returns the value of the key.
+func (s *Session) Get(key string) (interface{}, bool) {
+	_ = s.Load()
+	val, ok := s.values[key]
+	return val, ok
+}
+
+// Set saves the value of the key.
+func (s *Session) Set(key string, val interface{}) {
+	_ = s.Load()
+	s.values[key] = val
+	s.markDirty()
+}
+
+// Delete removes the value of the key.
+func (s *Session) Delete(key string) {
+	_ = s.Load()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.markDirty()
+	}
+}
+
+// Flash adds a message which can be read once by Flashes, usually in the next request.
+func (s *Session) Flash(val interface{}) {
+	_ = s.Load()
+	flashes, _ := s.values[flashesKey].([]interface{})
+	// the slice may be shared with the store and other requests, so it is never appended in place
+	copied := make([]interface{}, len(flashes), len(flashes)+1)
+	copy(copied, flashes)
+	s.values[flashesKey] = append(copied, val)
+	s.markDirty()
+}
+
+// Flashes returns all flash messages and removes them from the session.
+func (s *Session) Flashes() []interface{} {
+	_ = s.Load()
+	flashes, ok := s.values[flashesKey].([]interface{})
+	if !ok {
+		return nil
+	}
+	delete(s.values, flashesKey)
+	s.markDirty()
+	return flashes
+}
+
+// Regenerate moves the values to a new session id and removes the old session.  It should be called whenever the
+// privilege changes, such as sign in, to prevent session fixation.
+func (s *Session) Regenerate() error {
+	if err := s.Load(); err != nil {
+		return err
+	}
+	if len(s.id) > 0 {
+		if err := s.m.store.Delete(s.c.StdContext(), s.id); err != nil {
+			return err
+		}
+		s.id = ""
+	}
+	s.destroyed = false
+	s.markDirty()
+	return nil
+}
+
+// Destroy removes the session from the store and asks the client to delete the session cookie.
+func (s *Session) Destroy() error {
+	s.loaded = true
+	s.loadErr = nil
+	s.values = make(map[string]interface{})
+	s.dirty = false
+	s.destroyed = true
+
+	if len(s.id) == 0 {
+		return nil
+	}
+	err := s.m.store.Delete(s.c.StdContext(), s.id)
+	s.id = ""
+	s.removeSessionCookie()
+	s.c.DeleteCookie(s.m.opts.CookieName, &s.m.opts.Cookie)
+	return err
+}
+
+// Save stores the session if it was changed.  It is called by the middleware after the request automatically.
+func (s *Session) Save() error {
+	if !s.dirty || s.destroyed || s.loadErr != nil {
+		return nil
+	}
+	if err := s.m.store.Save(s.c.StdContext(), s.id, s.values, s.m.opts.TTL); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// markDirty flags the session to be saved and sends the session cookie if the session is new.  The cookie of an existing
+// session is sent again when it has a Max-Age, so it doesn't expire before the session which is saved with a new TTL.
+func (s *Session) markDirty() {
+	wasDirty := s.dirty
+	s.dirty = true
+	if len(s.id) == 0 {
+		s.id = newSessionID()
+		// a session which was destroyed before in the same request is started again
+		s.destroyed = false
+	} else if wasDirty || s.m.opts.Cookie.MaxAge <= 0 {
+		return
+	}
+	s.removeSessionCookie()
+	s.c.setCookie(s.m.opts.CookieName, s.id, &s.m.opts.Cookie)
+}
+
+// copyFor returns a copy of the session which is used by the context, so a handler with a deadline never changes
+// the session which is saved after a timeout.
+func (s *Session) copyFor(c *Context) *Session {
+	cp := *s
+	cp.c = c
+	if s.values != nil {
+		cp.values = make(map[string]interface{}, len(s.values))
+		for k, v := range s.values {
+			cp.values[k] = v
+		}
+	}
+	return &cp
+}
+
+// removeSessionCookie removes the session cookie which was added to the response before, such as the session
+// was regenerated after it was created in the same request.
+func (s *Session) removeSessionCookie() {
+	header := s.c.Writer.Header()
+	cookies := header["Set-Cookie"]
+	if len(cookies) == 0 {
+		return
+	}
+	prefix := s.m.opts.CookieName + "="
+	result := cookies[:0]
+	for _, cookie := range cookies {
+		if !strings.HasPrefix(cookie, prefix) {
+			result = append(result, cookie)
+		}
+	}
+	if len(result) == 0 {
+		header.Del("Set-Cookie")
+		return
+	}
+	header["Set-Cookie"] = result
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// isValidSessionID reports whether the id was generated by newSessionID, so it is safe to be used as a file name.
+func isValidSessionID(id string) bool {
+	if len(id) != 43 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		char := id[i]
+		if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '-' || char == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+type memorySession struct {
+	values  map[string]interface{}
+	expires time.Time
+}
+
+// MemorySessionStore stores sessions in memory.  Expired sessions are evicted periodically.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]memorySession
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemorySessionStore returns a memory session store which evicts expired sessions every interval.
+// If the interval is not positive, expired sessions are only evicted when they are loaded.
+func NewMemorySessionStore(interval time.Duration) *MemorySessionStore {
+	store := &MemorySessionStore{
+		sessions: make(map[string]memorySession),
+		stop:     make(chan struct{}),
+	}
+	if interval > 0 {
+		go store.evict(interval)
+	}
+	return store
+}
+
+// Load returns the values of the session.
+func (store *MemorySessionStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	store.mu.RLock()
+	session, ok := store.sessions[id]
+	store.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if time.Now().After(session.expires) {
+		_ = store.Delete(ctx, id)
+		return nil, ErrSessionNotFound
+	}
+	return session.values, nil
+}
+
+// Save stores the values of the session.
+func (store *MemorySessionStore) Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error {
+	copied := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+
+	store.mu.Lock()
+	store.sessions[id] = memorySession{
+		values:  copied,
+		expires: time.Now().Add(ttl),
+	}
+	store.mu.Unlock()
+	return nil
+}
+
+// Delete removes the session.
+func (store *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	store.mu.Lock()
+	delete(store.sessions, id)
+	store.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of sessions in the store.
+func (store *MemorySessionStore) Len() int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return len(store.sessions)
+}
+
+// Close stops evicting expired sessions.
+func (store *MemorySessionStore) Close() error {
+	store.stopOnce.Do(func() {
+		close(store.stop)
+	})
+	return nil
+}
+
+func (store *MemorySessionStore) evict(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			store.mu.Lock()
+			for id, session := range store.sessions {
+				if now.After(session.expires) {
+					delete(store.sessions, id)
+				}
+			}
+			store.mu.Unlock()
+		case <-store.stop:
+			return
+		}
+	}
+}
+
+type fileSession struct {
+	Values  map[string]interface{}
+	Expires time.Time
+}
+
+// FileSessionStore stores every session as a gob encoded file in a directory.
+// Custom types which are saved in sessions must be registered with gob.Register.
+type FileSessionStore struct {
+	dir string
+}
+
+// NewFileSessionStore returns a file session store.  The directory is created if it doesn't exist.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+func (store *FileSessionStore) path(id string) (string, error) {
+	if !isValidSessionID(id) {
+		return "", ErrSessionNotFound
+	}
+	return filepath.Join(store.dir, id+".session"), nil
+}
+
+// Load returns the values of the session.
+func (store *FileSessionStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	path, err := store.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var session fileSession
+	if err = gob.NewDecoder(f).Decode(&session); err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.Expires) {
+		_ = os.Remove(path)
+		return nil, ErrSessionNotFound
+	}
+	return session.Values, nil
+}
+
+// Save stores the values of the session.  The file is replaced atomically.
+func (store *FileSessionStore) Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) (err error) {
+	path, err := store.path(id)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(store.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	err = gob.NewEncoder(f).Encode(fileSession{
+		Values:  values,
+		Expires: time.Now().Add(ttl),
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Delete removes the session.
+func (store *FileSessionStore) Delete(ctx context.Context, id string) error {
+	path, err := store.path(id)
+	if err != nil {
+		return nil
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Cleanup removes the files of expired sessions.
+func (store *FileSessionStore) Cleanup() error {
+	files, err := filepath.Glob(filepath.Join(store.dir, "*.session"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		id := filepath.Base(file)
+		id = id[:len(id)-len(".session")]
+		if _, err := store.Load(context.Background(), id); err != nil && err != ErrSessionNotFound {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package napnap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sessionClient struct {
+	nap     *NapNap
+	cookies []*http.Cookie
+}
+
+func (client *sessionClient) get(path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	for _, cookie := range client.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	client.nap.ServeHTTP(w, req)
+
+	for _, cookie := range w.Result().Cookies() {
+		client.cookies = nil
+		if cookie.MaxAge >= 0 {
+			client.cookies = append(client.cookies, cookie)
+		}
+	}
+	return w
+}
+
+func newSessionTestApp(store SessionStore) *NapNap {
+	nap := New()
+	nap.Use(NewSessionMiddleware(store, SessionOptions{TTL: time.Hour}))
+	nap.Get("/login", func(c *Context) error {
+		if err := c.Session().Regenerate(); err != nil {
+			return err
+		}
+		c.Session().Set("user", "jason")
+		c.Session().Flash("welcome")
+		return c.String(200, c.Session().ID())
+	})
+	nap.Get("/me", func(c *Context) error {
+		user, _ := c.Session().Get("user")
+		flashes := c.Session().Flashes()
+		name, _ := user.(string)
+		if len(flashes) > 0 {
+			name += ":" + flashes[0].(string)
+		}
+		return c.String(200, name)
+	})
+	nap.Get("/logout", func(c *Context) error {
+		return c.Session().Destroy()
+	})
+	return nap
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	client := &sessionClient{nap: newSessionTestApp(store)}
+
+	// reading an empty session doesn't create one
+	w := client.get("/me")
+	assert.Equal(t, "", w.Body.String())
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	w = client.get("/login")
+	firstID := w.Body.String()
+	assert.Len(t, client.cookies, 1)
+	assert.Equal(t, firstID, client.cookies[0].Value)
+	assert.Equal(t, 3600, client.cookies[0].MaxAge)
+
+	w = client.get("/me")
+	assert.Equal(t, "jason:welcome", w.Body.String())
+	w = client.get("/me")
+	assert.Equal(t, "jason", w.Body.String())
+
+	// sign in again rotates the session id
+	w = client.get("/login")
+	secondID := w.Body.String()
+	assert.NotEqual(t, firstID, secondID)
+	_, err := store.Load(context.Background(), firstID)
+	assert.Equal(t, ErrSessionNotFound, err)
+	assert.Len(t, w.Header()["Set-Cookie"], 1)
+
+	w = client.get("/logout")
+	assert.Empty(t, client.cookies)
+	_, err = store.Load(context.Background(), secondID)
+	assert.Equal(t, ErrSessionNotFound, err)
+
+	w = client.get("/me")
+	assert.Equal(t, "", w.Body.String())
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	store := NewMemorySessionStore(time.Minute)
+	defer store.Close()
+	testSessionStore(t, store)
+}
+
+func TestFileSessionStore(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	assert.Nil(t, err)
+	testSessionStore(t, store)
+}
+
+func TestMemorySessionStoreEviction(t *testing.T) {
+	store := NewMemorySessionStore(5 * time.Millisecond)
+	defer store.Close()
+
+	id := newSessionID()
+	assert.Nil(t, store.Save(context.Background(), id, map[string]interface{}{"a": 1}, 10*time.Millisecond))
+	assert.Equal(t, 1, store.Len())
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestFileSessionStoreExpiration(t *testing.T) {
+	store, _ := NewFileSessionStore(t.TempDir())
+
+	id := newSessionID()
+	assert.Nil(t, store.Save(context.Background(), id, map[string]interface{}{"a": 1}, -time.Second))
+	_, err := store.Load(context.Background(), id)
+	assert.Equal(t, ErrSessionNotFound, err)
+
+	_, err = store.Load(context.Background(), "../../etc/passwd")
+	assert.Equal(t, ErrSessionNotFound, err)
+}
+
+func TestContextSessionWithoutMiddleware(t *testing.T) {
+	c, _, _ := createTestContext()
+	assert.Panics(t, func() { c.Session() })
+}
+
+func TestSessionFlashDoesNotShareStoredSlice(t *testing.T) {
+	store := NewMemorySessionStore(0)
+	m := NewSessionMiddleware(store, SessionOptions{})
+	id := newSessionID()
+	flashes := make([]interface{}, 1, 4)
+	flashes[0] = "first"
+	assert.Nil(t, store.Save(context.Background(), id, map[string]interface{}{flashesKey: flashes}, time.Minute))
+
+	newSession := func() *Session {
+		c, _, _ := createTestContext()
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+		return &Session{m: m, c: c, id: id}
+	}
+	// two requests of the same session load the stored slice before either one saves
+	a, b := newSession(), newSession()
+	_ = a.Load()
+	_ = b.Load()
+	a.Flash("a")
+	b.Flash("b")
+
+	assert.Equal(t, []interface{}{"first", "a"}, a.Flashes())
+	assert.Equal(t, []interface{}{"first", "b"}, b.Flashes())
+	assert.Equal(t, []interface{}{"first"}, flashes)
+}
+
+func TestSessionDestroyThenFlash(t *testing.T) {
+	nap := newSessionTestApp(NewMemorySessionStore(0))
+	nap.Get("/logout-flash", func(c *Context) error {
+		if err := c.Session().Destroy(); err != nil {
+			return err
+		}
+		c.Session().Flash("bye")
+		return nil
+	})
+	client := &sessionClient{nap: nap}
+
+	client.get("/login")
+	oldID := client.cookies[0].Value
+	w := client.get("/logout-flash")
+	assert.Len(t, w.Header()["Set-Cookie"], 1)
+	assert.Len(t, client.cookies, 1)
+	assert.NotEqual(t, oldID, client.cookies[0].Value)
+
+	// the flash of the new session was stored
+	w = client.get("/me")
+	assert.Equal(t, ":bye", w.Body.String())
+}
+
+func TestSessionCookieIsRefreshed(t *testing.T) {
+	client := &sessionClient{nap: newSessionTestApp(NewMemorySessionStore(0))}
+	client.get("/login")
+	id := client.cookies[0].Value
+
+	// the session is saved again with a new TTL, so the cookie is extended too
+	w := client.get("/me")
+	assert.Len(t, w.Header()["Set-Cookie"], 1)
+	assert.Equal(t, id, client.cookies[0].Value)
+	assert.Equal(t, 3600, client.cookies[0].MaxAge)
+
+	// an unchanged session isn't saved, so the cookie isn't sent
+	w = client.get("/me")
+	assert.Empty(t, w.Header()["Set-Cookie"])
+}
@@ -0,0 +1,232 @@
+package napnap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// OnShutdown registers a function which is called by Shutdown before the servers are drained, such as to fail
+// the readiness checks.  The functions are called in the order they were registered.
+func (nap *NapNap) OnShutdown(fn func(ctx context.Context) error) {
+	nap.lifecycleMu.Lock()
+	defer nap.lifecycleMu.Unlock()
+	nap.shutdownHooks = append(nap.shutdownHooks, fn)
+}
+
+// Shutdown gracefully stops all servers which were started by the Run methods.  It changes the state to draining,
+// closes the Draining channel, calls the OnShutdown functions, stops accepting connections and waits for the active
+// requests until the context is done.  The contexts of the requests which are still active are canceled afterwards.
+// The OnStopped functions are called after the servers were drained.
+// The Run methods return nil once the servers were drained.  Later calls wait for the first one.
+func (nap *NapNap) Shutdown(ctx context.Context) error {
+	nap.shutdownOnce.Do(func() {
+		nap.state.Store(int32(StateDraining))
+		close(nap.shutdownCh)
+		defer close(nap.shutdownDone)
+
+		nap.lifecycleMu.Lock()
+		hooks := append([]func(ctx context.Context) error(nil), nap.shutdownHooks...)
+		stoppedHooks := append(([]func())(nil), nap.stoppedHooks...)
+		servers := make([]*http.Server, 0, len(nap.servers))
+		engines := make([]*Server, 0, len(nap.servers))
+		for srv, ts := range nap.servers {
+			servers = append(servers, srv)
+			engines = append(engines, ts.engine)
+		}
+		nap.lifecycleMu.Unlock()
+
+		var errs []error
+		for _, hook := range hooks {
+			if err := hook(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, engine := range engines {
+			errs = append(errs, engine.shutdown(ctx)...)
+		}
+		errs = append(errs, shutdownServers(ctx, servers))
+		// the grace period is over, so the requests which are still active are told to stop
+		nap.drainCancel()
+		nap.shutdownErr = errors.Join(errs...)
+
+		nap.state.Store(int32(StateStopped))
+		for _, hook := range stoppedHooks {
+			hook()
+		}
+		for _, engine := range engines {
+			engine.stopped()
+		}
+	})
+
+	select {
+	case <-nap.shutdownDone:
+		return nap.shutdownErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Draining returns a channel which is closed when Shutdown is called.  Streams and long polls, which would hold the drain
+// until the grace period is over, should return when it is closed.
+func (nap *NapNap) Draining() <-chan struct{} {
+	return nap.shutdownCh
+}
+
+// shutdownServers drains the servers at the same time.
+func shutdownServers(ctx context.Context, servers []*http.Server) error {
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			errCh <- srv.Shutdown(ctx)
+		}(srv)
+	}
+	var errs []error
+	for range servers {
+		if err := <-errCh; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// serve calls the OnStart functions, listens on the address of the server and serves until it fails or Shutdown
+// finished draining.  The hooks of the engine are called too when it is given.
+// The server is served with tls when the serveTLS function is given.
+func (nap *NapNap) serve(srv *http.Server, engine *Server, serveTLS func(ln net.Listener) error) error {
+	if !nap.track(srv, engine) {
+		return http.ErrServerClosed
+	}
+	defer nap.untrack(srv)
+	if err := nap.start(); err != nil {
+		return err
+	}
+	if err := engine.start(); err != nil {
+		return err
+	}
+	nap.watchSignals()
+	nap.cancelOnDrain(srv)
+
+	addr := srv.Addr
+	if len(addr) == 0 {
+		addr = ":http"
+		if serveTLS != nil {
+			addr = ":https"
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	nap.listening(srv, ln.Addr())
+	engine.listening(ln.Addr())
+
+	if serveTLS != nil {
+		err = serveTLS(ln)
+	} else {
+		err = srv.Serve(ln)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	select {
+	case <-nap.shutdownCh:
+		<-nap.shutdownDone
+	default:
+		// the server was stopped by serveAll or by the user
+	}
+	return nil
+}
+
+// serveAll serves all servers and returns the first error.  The other servers are stopped gracefully when one fails.
+func (nap *NapNap) serveAll(servers []*http.Server, serve []func() error) error {
+	errCh := make(chan error, len(serve))
+	for _, fn := range serve {
+		go func(fn func() error) {
+			errCh <- fn()
+		}(fn)
+	}
+
+	var firstErr error
+	for range serve {
+		err := <-errCh
+		if err == nil || firstErr != nil {
+			continue
+		}
+		firstErr = err
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), nap.ShutdownTimeout)
+			defer cancel()
+			_ = shutdownServers(ctx, servers)
+		}()
+	}
+	return firstErr
+}
+
+// cancelOnDrain derives the contexts of the requests of the server from a context which is canceled by Shutdown
+// when the grace period is over.
+func (nap *NapNap) cancelOnDrain(srv *http.Server) {
+	base := srv.BaseContext
+	srv.BaseContext = func(ln net.Listener) context.Context {
+		ctx := context.Background()
+		if base != nil {
+			ctx = base(ln)
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		context.AfterFunc(nap.drainCtx, cancel)
+		return ctx
+	}
+}
+
+// track adds the server to the servers which are drained by Shutdown.  It returns false when Shutdown was called.
+func (nap *NapNap) track(srv *http.Server, engine *Server) bool {
+	nap.lifecycleMu.Lock()
+	defer nap.lifecycleMu.Unlock()
+	select {
+	case <-nap.shutdownCh:
+		return false
+	default:
+	}
+	if nap.servers == nil {
+		nap.servers = make(map[*http.Server]*trackedServer)
+	}
+	nap.servers[srv] = &trackedServer{engine: engine}
+	return true
+}
+
+func (nap *NapNap) untrack(srv *http.Server) {
+	nap.lifecycleMu.Lock()
+	defer nap.lifecycleMu.Unlock()
+	delete(nap.servers, srv)
+}
+
+// watchSignals calls Shutdown with ShutdownTimeout when one of the ShutdownSignals is received.
+func (nap *NapNap) watchSignals() {
+	if len(nap.ShutdownSignals) == 0 {
+		return
+	}
+	nap.signalOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, nap.ShutdownSignals...)
+		go func() {
+			defer signal.Stop(ch)
+			select {
+			case sig := <-ch:
+				nap.Logger.Info("napnap: shutting down", "signal", sig.String(), "timeout", nap.ShutdownTimeout)
+				ctx, cancel := context.WithTimeout(context.Background(), nap.ShutdownTimeout)
+				defer cancel()
+				if err := nap.Shutdown(ctx); err != nil {
+					nap.Logger.Error("napnap: shutdown failed", "error", err)
+				}
+			case <-nap.shutdownCh:
+			}
+		}()
+	})
+}
+
+// defaultShutdownTimeout is the default grace period for the active requests.
+const defaultShutdownTimeout = 10 * time.Second
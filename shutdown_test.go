@@ -0,0 +1,205 @@
+package napnap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func waitForServer(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server %s didn't start", addr)
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	nap := New()
+	nap.ShutdownSignals = nil
+	started := make(chan struct{})
+	nap.Get("/slow", func(c *Context) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		return c.String(200, "done")
+	})
+	var hookCalled bool
+	nap.OnShutdown(func(ctx context.Context) error {
+		hookCalled = true
+		return nil
+	})
+
+	addr := freeAddr(t)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- nap.Run(NewHTTPEngine(addr))
+	}()
+	waitForServer(t, addr)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	<-started
+
+	assert.NoError(t, nap.Shutdown(context.Background()))
+	assert.True(t, hookCalled)
+	assert.Equal(t, "done", <-body)
+	assert.NoError(t, <-runErr)
+
+	// servers can't be started after shutdown
+	assert.Equal(t, http.ErrServerClosed, nap.Run(NewHTTPEngine(freeAddr(t))))
+}
+
+func TestRunAllReturnsFirstError(t *testing.T) {
+	nap := New()
+	nap.ShutdownSignals = nil
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer busy.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- nap.RunAll([]string{freeAddr(t), busy.Addr().String()})
+	}()
+
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunAll didn't return")
+	}
+}
+
+func TestShutdownCancelsStreams(t *testing.T) {
+	nap := New()
+	nap.ShutdownSignals = nil
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	nap.Get("/events", func(c *Context) error {
+		es := c.SSE()
+		close(started)
+		<-es.Done()
+		close(stopped)
+		return nil
+	})
+	listening := make(chan net.Addr, 1)
+	nap.OnListening(func(addr net.Addr) {
+		listening <- addr
+	})
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- nap.Run(NewHTTPEngine("127.0.0.1:0"))
+	}()
+	addr := <-listening
+
+	go func() {
+		resp, err := http.Get("http://" + addr.String() + "/events")
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	begin := time.Now()
+	assert.NoError(t, nap.Shutdown(ctx))
+	assert.True(t, time.Since(begin) < 3*time.Second)
+	<-stopped
+	assert.NoError(t, <-runErr)
+}
+
+func TestShutdownKeepsRequestContexts(t *testing.T) {
+	nap := New()
+	nap.ShutdownSignals = nil
+	started := make(chan struct{})
+	nap.Get("/slow", func(c *Context) error {
+		close(started)
+		select {
+		case <-c.StdContext().Done():
+			return c.String(500, "canceled")
+		case <-time.After(100 * time.Millisecond):
+		}
+		assert.False(t, c.ClientDisconnected())
+		return c.String(200, "done")
+	})
+	waiting := make(chan struct{})
+	nap.Get("/wait", func(c *Context) error {
+		close(waiting)
+		<-c.StdContext().Done()
+		return nil
+	})
+	listening := make(chan net.Addr, 1)
+	nap.OnListening(func(addr net.Addr) {
+		listening <- addr
+	})
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- nap.Run(NewHTTPEngine("127.0.0.1:0"))
+	}()
+	addr := <-listening
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr.String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	<-started
+	waitDone := make(chan struct{})
+	go func() {
+		defer close(waitDone)
+		resp, err := http.Get("http://" + addr.String() + "/wait")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-waiting
+
+	// the request which honors its context finishes during the drain, the one which waits for it is canceled afterwards
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(nap.Shutdown(ctx), context.DeadlineExceeded))
+	assert.Equal(t, "done", <-body)
+	select {
+	case <-waitDone:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the request context wasn't canceled after the grace period")
+	}
+	assert.NoError(t, <-runErr)
+}
@@ -0,0 +1,199 @@
+package napnap
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrEventStreamClosed is returned when writing to an event stream which was closed or whose client has gone away.
+	ErrEventStreamClosed = errors.New("napnap: event stream was closed")
+)
+
+// Event is a single server-sent event.
+type Event struct {
+	// Event is the event type.  The browser dispatches `message` events if it is empty.
+	Event string
+	// ID is the event id which the browser sends back in the Last-Event-ID header when it reconnects.
+	ID string
+	// Data is the payload of the event.  Strings and byte slices are sent as they are, other values are json encoded.
+	Data interface{}
+	// Retry tells the browser how long it should wait before reconnecting.
+	Retry time.Duration
+}
+
+// EventStream writes server-sent events (text/event-stream) to the client.
+// Done is closed when the client has gone away or NapNap.Shutdown is called, so the handler can return before the drain.
+// It is closed when the handler returns, so the keep-alive goroutine never writes to a recycled context.
+type EventStream struct {
+	c      *Context
+	mu     sync.Mutex
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// SSE prepares the response for server-sent events and returns an event stream writer.
+func (c *Context) SSE() *EventStream {
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// disable response buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	header.Del("Content-Length")
+	c.Writer.WriteHeader(200)
+	c.flush()
+
+	es := &EventStream{
+		c:    c,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(es.done)
+		select {
+		case <-c.Request.Context().Done():
+		case <-c.NapNap.Draining():
+		case <-es.stop:
+		}
+	}()
+	c.onFinish(es.Close)
+	return es
+}
+
+// LastEventID returns the id of the last event the client received before it reconnected.
+func (es *EventStream) LastEventID() string {
+	return es.c.RequestHeader("Last-Event-ID")
+}
+
+// Done returns a channel which is closed when the client has gone away, the server is shutting down or the stream was closed.
+func (es *EventStream) Done() <-chan struct{} {
+	return es.done
+}
+
+// Send writes an event to the client and flushes it immediately.
+func (es *EventStream) Send(event, id string, data interface{}) error {
+	return es.SendEvent(Event{Event: event, ID: id, Data: data})
+}
+
+// SendEvent writes an event to the client and flushes it immediately.
+func (es *EventStream) SendEvent(e Event) error {
+	var sb strings.Builder
+	if len(e.Event) > 0 {
+		sb.WriteString("event: ")
+		sb.WriteString(sanitizeEventField(e.Event))
+		sb.WriteByte('\n')
+	}
+	if len(e.ID) > 0 {
+		sb.WriteString("id: ")
+		sb.WriteString(strings.ReplaceAll(sanitizeEventField(e.ID), "\x00", ""))
+		sb.WriteByte('\n')
+	}
+	if e.Retry > 0 {
+		sb.WriteString("retry: ")
+		sb.WriteString(strconv.FormatInt(e.Retry.Milliseconds(), 10))
+		sb.WriteByte('\n')
+	}
+
+	var data string
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r", "\n"), "\n") {
+		sb.WriteString("data: ")
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+
+	return es.write(sb.String())
+}
+
+// Retry tells the browser how long it should wait before reconnecting when the connection is lost.
+func (es *EventStream) Retry(d time.Duration) error {
+	return es.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+// Comment writes a comment line which is ignored by the browser.
+func (es *EventStream) Comment(text string) error {
+	return es.write(": " + sanitizeEventField(text) + "\n\n")
+}
+
+// KeepAlive sends a comment periodically, so proxies don't close the idle connection.
+// It stops when the stream is closed, the handler returned or the client has gone away.
+func (es *EventStream) KeepAlive(interval time.Duration) {
+	es.wg.Add(1)
+	go func() {
+		defer es.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := es.Comment("keep-alive"); err != nil {
+					return
+				}
+			case <-es.stop:
+				return
+			case <-es.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the keep-alive goroutine and rejects further events.
+func (es *EventStream) Close() {
+	es.mu.Lock()
+	if es.closed {
+		es.mu.Unlock()
+		return
+	}
+	es.closed = true
+	close(es.stop)
+	es.mu.Unlock()
+	es.wg.Wait()
+}
+
+func (es *EventStream) write(content string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if es.closed {
+		return ErrEventStreamClosed
+	}
+	if err := es.c.Request.Context().Err(); err != nil {
+		return ErrEventStreamClosed
+	}
+
+	_, err := es.c.Writer.Write([]byte(content))
+	if err != nil {
+		return err
+	}
+	es.c.flush()
+	return nil
+}
+
+// sanitizeEventField removes line breaks which would terminate the field early.
+func sanitizeEventField(s string) string {
+	if strings.ContainsAny(s, "\r\n") {
+		s = strings.NewReplacer("\r", "", "\n", "").Replace(s)
+	}
+	return s
+}
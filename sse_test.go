@@ -0,0 +1,106 @@
+package napnap
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSESendEvents(t *testing.T) {
+	nap := New()
+	nap.Get("/events", func(c *Context) error {
+		stream := c.SSE()
+		defer stream.Close()
+
+		assert.Equal(t, "41", stream.LastEventID())
+		_ = stream.Retry(3 * time.Second)
+		_ = stream.Send("order", "42", "line1\nline2")
+		_ = stream.Send("", "43", map[string]string{"status": "paid"})
+		_ = stream.Comment("bye")
+		return nil
+	})
+
+	ts := httptest.NewServer(nap)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "41")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		sb.WriteString(scanner.Text() + "\n")
+	}
+
+	expected := "retry: 3000\n\n" +
+		"event: order\nid: 42\ndata: line1\ndata: line2\n\n" +
+		"id: 43\ndata: {\"status\":\"paid\"}\n\n" +
+		": bye\n\n"
+	assert.Equal(t, expected, sb.String())
+}
+
+func TestSSEStopsWhenClientGoesAway(t *testing.T) {
+	result := make(chan error, 1)
+
+	nap := New()
+	nap.Get("/events", func(c *Context) error {
+		stream := c.SSE()
+		defer stream.Close()
+		stream.KeepAlive(10 * time.Millisecond)
+
+		_ = stream.Send("ping", "", "hello")
+		<-stream.Done()
+		result <- stream.Send("ping", "", "hello again")
+		return nil
+	})
+
+	ts := httptest.NewServer(nap)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+
+	reader := bufio.NewReader(resp.Body)
+	line, _ := reader.ReadString('\n')
+	assert.Equal(t, "event: ping\n", line)
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case err := <-result:
+		assert.Equal(t, ErrEventStreamClosed, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event stream wasn't terminated")
+	}
+}
+
+func TestSSEClosedWhenHandlerReturns(t *testing.T) {
+	var stream *EventStream
+	nap := New()
+	nap.Get("/events", func(c *Context) error {
+		stream = c.SSE()
+		stream.KeepAlive(time.Millisecond)
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "/events", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the keep-alive goroutine was stopped before the context was recycled
+	assert.Equal(t, ErrEventStreamClosed, stream.Comment("late"))
+	stream.wg.Wait()
+}
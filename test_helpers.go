@@ -11,7 +11,7 @@ func createTestContext() (*Context, *httptest.ResponseRecorder, *NapNap) {
 		Writer: NewResponseWriter(),
 	}
 	c.NapNap = nap
-	c.Writer.reset(w)
+	c.Writer = c.Writer.reset(w)
 	//c := NewContext(nap, nil, w)
 	return c, w, nap
 }
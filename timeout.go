@@ -0,0 +1,267 @@
+package napnap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrHandlerTimeout is returned to ErrorHandler when a handler doesn't finish before its deadline.
+	ErrHandlerTimeout = NewHTTPError(http.StatusServiceUnavailable, "handler timeout")
+	// ErrGatewayTimeout can be used with TimeoutWithError when the handler mostly waits for upstream services.
+	ErrGatewayTimeout = NewHTTPError(http.StatusGatewayTimeout, "")
+)
+
+// Timeout wraps the handler so it is bounded by the duration.  See TimeoutWithError.
+func Timeout(d time.Duration, h HandlerFunc) HandlerFunc {
+	return TimeoutWithError(d, ErrHandlerTimeout, h)
+}
+
+// TimeoutWithError wraps the handler so it is bounded by the duration.  The handler runs with a deadline which can
+// be read from StdContext().  If the deadline passes before the handler returns, the timeout error is passed to ErrorHandler
+// and the later writes of the handler fail with http.ErrHandlerTimeout.  The handler keeps running until it returns,
+// so it should stop when StdContext().Done() is closed.
+// The handler gets a copy of the context, which is merged back when it returns in time.  After a timeout the middleware
+// in front only sees the error response and the values from before the handler, so it never races with the handler.
+func TimeoutWithError(d time.Duration, timeoutErr error, h HandlerFunc) HandlerFunc {
+	return func(c *Context) error {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{
+			w:      c.Writer,
+			header: c.Writer.Header().Clone(),
+			status: defaultStatus,
+		}
+		hc := c.handlerCopy(tw)
+		hc.SetStdContext(ctx)
+
+		done := make(chan error, 1)
+		panicChan := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicChan <- p
+				}
+			}()
+			err := h(hc)
+			tw.mu.Lock()
+			if tw.timedOut {
+				tw.mu.Unlock()
+				// nobody merges the context anymore
+				hc.finish()
+				return
+			}
+			tw.handlerDone = true
+			tw.mu.Unlock()
+			done <- err
+		}()
+
+		select {
+		case p := <-panicChan:
+			panic(p)
+		case err := <-done:
+			c.merge(hc)
+			return err
+		case <-ctx.Done():
+			tw.mu.Lock()
+			tw.timedOut = true
+			wroteHeader := tw.wroteHeader
+			handlerDone := tw.handlerDone
+			tw.mu.Unlock()
+
+			if handlerDone {
+				// the handler returned at the deadline, so it doesn't use the copy anymore
+				c.merge(hc)
+			} else {
+				// the handler may still write to the response writer through the timeoutWriter
+				c.detached = true
+			}
+			if !wroteHeader {
+				c.handleError(timeoutErr)
+			}
+			return nil
+		}
+	}
+}
+
+// handlerCopy returns a copy of the context for a handler with a deadline which writes to w.
+func (c *Context) handlerCopy(w ResponseWriter) *Context {
+	hc := &Context{
+		NapNap:       c.NapNap,
+		Request:      c.Request,
+		Writer:       w,
+		params:       append([]Param(nil), c.params...),
+		requestID:    c.requestID,
+		routePattern: c.routePattern,
+		logger:       c.logger,
+	}
+	if c.store != nil {
+		hc.store = make(map[interface{}]interface{}, len(c.store))
+		for k, v := range c.store {
+			hc.store[k] = v
+		}
+	}
+	if c.session != nil {
+		hc.session = c.session.copyFor(hc)
+	}
+	return hc
+}
+
+// merge takes over the changes of the handler which returned in time.
+func (c *Context) merge(hc *Context) {
+	c.params = hc.params
+	c.query = hc.query
+	c.store = hc.store
+	c.requestID = hc.requestID
+	c.routePattern = hc.routePattern
+	c.logger = hc.logger
+	c.finishers = append(c.finishers, hc.finishers...)
+	if c.session != nil && hc.session != nil {
+		*c.session = *hc.session
+		c.session.c = c
+	}
+}
+
+// ClientDisconnected returns true when the client closed the connection before the response was finished.
+func (c *Context) ClientDisconnected() bool {
+	return errors.Is(c.Request.Context().Err(), context.Canceled)
+}
+
+// handleError passes the error to ErrorHandler.  A buffered response which wasn't sent yet is discarded first.
+// Without ErrorHandler the error is logged and only the status of errors which carry one, such as HTTPError, is sent.
+func (c *Context) handleError(err error) {
+	if bw, ok := c.Writer.(*bufferedWriter); ok {
+		// replace the partial output of the handler with the error response
+		bw.discard()
+	}
+	if c.NapNap.ErrorHandler != nil {
+		c.NapNap.ErrorHandler(c, err)
+		return
+	}
+	code, ok := errorStatusCode(err)
+	if code >= http.StatusInternalServerError {
+		c.Logger().Error("napnap: request failed", "status", code, "error", err)
+	}
+	if ok && !c.Writer.Written() {
+		c.SetStatus(code)
+	}
+}
+
+// timeoutWriter passes writes through until the deadline passes.  The handler has its own header map,
+// so it never races with the error response.
+type timeoutWriter struct {
+	w           ResponseWriter
+	mu          sync.Mutex
+	header      http.Header
+	status      int
+	wroteHeader bool
+	timedOut    bool
+	// handlerDone is set when the handler returned before the timeout was handled.
+	handlerDone bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeaderLocked(statusCode)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(statusCode int) {
+	if tw.wroteHeader {
+		return
+	}
+	dst := tw.w.Header()
+	for k := range dst {
+		if _, ok := tw.header[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.status = statusCode
+	tw.wroteHeader = true
+	tw.w.WriteHeader(statusCode)
+}
+
+// Flush implements the http.Flusher interface.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	if flusher, ok := tw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface.  A connection can't be taken over by a handler with a deadline.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("napnap: hijack: %w", http.ErrNotSupported)
+}
+
+func (tw *timeoutWriter) ContentLength() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.w.ContentLength()
+}
+
+func (tw *timeoutWriter) BytesWritten() int64 {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.w.BytesWritten()
+}
+
+func (tw *timeoutWriter) Written() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.wroteHeader
+}
+
+func (tw *timeoutWriter) HeaderWrittenAt() time.Time {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.w.HeaderWrittenAt()
+}
+
+func (tw *timeoutWriter) FirstByteAt() time.Time {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.w.FirstByteAt()
+}
+
+func (tw *timeoutWriter) Status() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.status
+}
+
+func (tw *timeoutWriter) reset(writer http.ResponseWriter) ResponseWriter {
+	return tw.w.reset(writer)
+}
@@ -0,0 +1,135 @@
+package napnap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	nap := New()
+	nap.ErrorHandler = DefaultErrorHandler
+	lateWrite := make(chan error, 1)
+	nap.Get("/slow", Timeout(20*time.Millisecond, func(c *Context) error {
+		<-c.StdContext().Done()
+		time.Sleep(10 * time.Millisecond)
+		lateWrite <- c.String(200, "late")
+		return nil
+	}))
+	nap.Get("/fast", Timeout(time.Second, func(c *Context) error {
+		_, hasDeadline := c.StdContext().Deadline()
+		c.RespHeader("X-Deadline", "true")
+		assert.True(t, hasDeadline)
+		return c.String(200, "fast")
+	}))
+
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"code":503,"message":"handler timeout"}`, w.Body.String())
+	assert.Equal(t, http.ErrHandlerTimeout, <-lateWrite)
+	assert.Equal(t, `{"code":503,"message":"handler timeout"}`, w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/fast", nil)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "fast", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("X-Deadline"))
+}
+
+func TestTimeoutErrorHandler(t *testing.T) {
+	nap := New()
+	var handled error
+	nap.ErrorHandler = func(c *Context, err error) {
+		handled = err
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			_ = c.String(httpErr.StatusCode(), "custom")
+		}
+	}
+	nap.Get("/slow", TimeoutWithError(10*time.Millisecond, ErrGatewayTimeout, func(c *Context) error {
+		<-c.StdContext().Done()
+		return c.StdContext().Err()
+	}))
+	nap.Get("/fail", Timeout(time.Second, func(c *Context) error {
+		return NewHTTPError(http.StatusConflict, "")
+	}))
+
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, ErrGatewayTimeout, handled)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "custom", w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/fail", nil)
+	w = httptest.NewRecorder()
+	nap.ServeHTTP(w, req)
+	assert.Equal(t, "Conflict", handled.Error())
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestContextClientDisconnected(t *testing.T) {
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	assert.False(t, c.ClientDisconnected())
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	c.SetStdContext(ctx)
+	cancel()
+	assert.True(t, c.ClientDisconnected())
+}
+
+func TestTimeoutHijack(t *testing.T) {
+	nap := New()
+	var hijackErr error
+	nap.Get("/ws", Timeout(time.Second, func(c *Context) error {
+		_, _, hijackErr = http.NewResponseController(c.Writer).Hijack()
+		return nil
+	}))
+
+	req, _ := http.NewRequest("GET", "/ws", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, errors.Is(hijackErr, http.ErrNotSupported))
+}
+
+func TestTimeoutContextCopy(t *testing.T) {
+	nap := New()
+	var outer []interface{}
+	nap.UseFunc(func(c *Context, next HandlerFunc) {
+		c.Set("user", "user1")
+		_ = next(c)
+		val, _ := c.Get("user")
+		outer = append(outer, val)
+	})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	nap.Get("/slow", Timeout(10*time.Millisecond, func(c *Context) error {
+		defer close(finished)
+		<-release
+		c.Set("user", "late")
+		return nil
+	}))
+	nap.Get("/fast", Timeout(time.Second, func(c *Context) error {
+		c.Set("user", "user2")
+		return nil
+	}))
+
+	// the changes of the handler are dropped after a timeout
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	close(release)
+	<-finished
+
+	// the changes of the handler which returned in time are merged
+	req, _ = http.NewRequest("GET", "/fast", nil)
+	nap.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, []interface{}{"user1", "user2"}, outer)
+}
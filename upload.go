@@ -0,0 +1,365 @@
+package napnap
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultMaxFieldSize = 1 << 20 // 1 MB
+	sniffLen            = 512
+)
+
+var (
+	// ErrFileTooLarge is returned when an uploaded file exceeds UploadOptions.MaxFileSize.
+	ErrFileTooLarge = errors.New("file is too large")
+	// ErrUploadTooLarge is returned when all uploaded files and fields exceed UploadOptions.MaxTotalSize.
+	ErrUploadTooLarge = errors.New("upload is too large")
+	// ErrTooManyFiles is returned when the number of uploaded files exceeds UploadOptions.MaxFiles.
+	ErrTooManyFiles = errors.New("too many files")
+	// ErrFileTypeNotAllowed is returned when the sniffed content type isn't in UploadOptions.AllowedTypes.
+	ErrFileTypeNotAllowed = errors.New("file type is not allowed")
+)
+
+// UploadError is returned when an upload violates the limits of UploadOptions.
+type UploadError struct {
+	// Field is the form field name of the part.
+	Field string
+	// FileName is the file name which the client sent.
+	FileName string
+	Err      error
+}
+
+func (e *UploadError) Error() string {
+	if len(e.Field) == 0 {
+		return "upload: " + e.Err.Error()
+	}
+	if len(e.FileName) > 0 {
+		return "upload \"" + e.Field + "\" (" + e.FileName + "): " + e.Err.Error()
+	}
+	return "upload \"" + e.Field + "\": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns 413 (Request Entity Too Large) for size violations, 415 (Unsupported Media Type) for
+// disallowed file types and 400 (Bad Request) otherwise.
+func (e *UploadError) StatusCode() int {
+	switch e.Err {
+	case ErrFileTooLarge, ErrUploadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ErrFileTypeNotAllowed:
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+// FileStore stores uploaded files.
+type FileStore interface {
+	// Save writes the content to the store and returns the key which identifies the file.
+	// The name is the file name which the client sent and must be treated as untrusted.
+	Save(ctx context.Context, name string, r io.Reader) (string, error)
+	// Delete removes the file of the key.
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalFileStore stores uploaded files in a local directory with random names.
+type LocalFileStore struct {
+	dir string
+}
+
+// NewLocalFileStore returns a local file store.  The directory is created if it doesn't exist.
+func NewLocalFileStore(dir string) (*LocalFileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalFileStore{dir: dir}, nil
+}
+
+// Save writes the content to a new file whose name is random and keeps the extension of the name.
+// The returned key is the file name in the directory.
+func (store *LocalFileStore) Save(ctx context.Context, name string, r io.Reader) (key string, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return "", err
+	}
+	key = hex.EncodeToString(b) + sanitizeExt(filepath.Ext(name))
+
+	out, err := os.OpenFile(filepath.Join(store.dir, key), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(out.Name())
+		}
+	}()
+
+	_, err = io.Copy(out, r)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Delete removes the file of the key.
+func (store *LocalFileStore) Delete(ctx context.Context, key string) error {
+	if key != filepath.Base(key) {
+		return errors.New("napnap: invalid file key")
+	}
+	err := os.Remove(filepath.Join(store.dir, key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Path returns the path of the file of the key.
+func (store *LocalFileStore) Path(key string) string {
+	return filepath.Join(store.dir, filepath.Base(key))
+}
+
+// UploadOptions configures how multipart uploads are received.
+type UploadOptions struct {
+	// Store is where the files are written to.  It is required.
+	Store FileStore
+	// MaxFileSize is the maximum size in bytes of a single file.  Default value is 0 which means no limit.
+	MaxFileSize int64
+	// MaxTotalSize is the maximum size in bytes of all files and fields.  Default value is 0 which means no limit,
+	// but NapNap.MaxRequestBodySize still applies.
+	MaxTotalSize int64
+	// MaxFieldSize is the maximum size in bytes of a non-file field.  Default value is 1MB
+	MaxFieldSize int64
+	// MaxFiles is the maximum number of files.  Default value is 0 which means no limit.
+	MaxFiles int
+	// AllowedTypes is a list of content types which are sniffed from the content of files, such as "image/png" or "image/*".
+	// Default value is empty which means all types are allowed.
+	AllowedTypes []string
+	// Hash creates the hash which is computed while the file is written.  Default value is sha256.New
+	Hash func() hash.Hash
+}
+
+// UploadedFile describes a file which was written to the store.
+type UploadedFile struct {
+	// Field is the form field name of the part.
+	Field string
+	// FileName is the file name which the client sent.
+	FileName string
+	// ContentType is sniffed from the content, so the client can't fake it.
+	ContentType string
+	Size        int64
+	// Hash is the hex encoded hash of the content.
+	Hash string
+	// Key identifies the file in the store.
+	Key string
+}
+
+// UploadResult is the result of ReceiveFiles.
+type UploadResult struct {
+	Fields url.Values
+	Files  []*UploadedFile
+}
+
+// MultipartReader returns a reader which reads the parts of a multipart/form-data body as they arrive.
+func (c *Context) MultipartReader() (*multipart.Reader, error) {
+	return c.Request.MultipartReader()
+}
+
+// ReceiveFiles streams the parts of a multipart/form-data body as they arrive, so the body is never buffered
+// in memory or temporary files.  Files are checked and hashed on the fly and written to the store.
+// If anything fails, files which were already written are deleted and an *UploadError is returned for limit violations,
+// including a body which is larger than NapNap.MaxRequestBodySize.
+func (c *Context) ReceiveFiles(opts *UploadOptions) (*UploadResult, error) {
+	if opts == nil || opts.Store == nil {
+		return nil, errors.New("napnap: UploadOptions.Store is required")
+	}
+	reader, err := c.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := c.StdContext()
+	result := &UploadResult{Fields: url.Values{}}
+	total := &limitCounter{limit: opts.MaxTotalSize, err: ErrUploadTooLarge}
+
+	cleanup := func() {
+		for _, file := range result.Files {
+			_ = opts.Store.Delete(ctx, file.Key)
+		}
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			cleanup()
+			if isMaxBytesError(err) {
+				return nil, &UploadError{Err: ErrUploadTooLarge}
+			}
+			return nil, err
+		}
+
+		if len(part.FileName()) == 0 {
+			err = receiveField(part, opts, total, result)
+		} else {
+			err = receiveFile(ctx, part, opts, total, result)
+		}
+		part.Close()
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+}
+
+func receiveField(part *multipart.Part, opts *UploadOptions, total *limitCounter, result *UploadResult) error {
+	maxFieldSize := opts.MaxFieldSize
+	if maxFieldSize <= 0 {
+		maxFieldSize = defaultMaxFieldSize
+	}
+	field := &limitCounter{limit: maxFieldSize, err: ErrUploadTooLarge}
+
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(io.TeeReader(part, io.MultiWriter(field, total)))
+	if err != nil {
+		return uploadError(part, err)
+	}
+	result.Fields.Add(part.FormName(), buf.String())
+	return nil
+}
+
+func receiveFile(ctx context.Context, part *multipart.Part, opts *UploadOptions, total *limitCounter, result *UploadResult) error {
+	if opts.MaxFiles > 0 && len(result.Files) >= opts.MaxFiles {
+		return uploadError(part, ErrTooManyFiles)
+	}
+
+	file := &limitCounter{limit: opts.MaxFileSize, err: ErrFileTooLarge}
+	counted := io.TeeReader(part, io.MultiWriter(file, total))
+
+	// sniff the content type from the beginning of the file
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(counted, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return uploadError(part, err)
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if !isAllowedType(contentType, opts.AllowedTypes) {
+		return uploadError(part, ErrFileTypeNotAllowed)
+	}
+
+	newHash := opts.Hash
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	h := newHash()
+	_, _ = h.Write(head)
+
+	key, err := opts.Store.Save(ctx, part.FileName(), io.MultiReader(bytes.NewReader(head), io.TeeReader(counted, h)))
+	if err != nil {
+		return uploadError(part, err)
+	}
+
+	result.Files = append(result.Files, &UploadedFile{
+		Field:       part.FormName(),
+		FileName:    part.FileName(),
+		ContentType: contentType,
+		Size:        file.n,
+		Hash:        hex.EncodeToString(h.Sum(nil)),
+		Key:         key,
+	})
+	return nil
+}
+
+func uploadError(part *multipart.Part, err error) error {
+	var limitErr *limitError
+	if errors.As(err, &limitErr) {
+		err = limitErr.err
+	} else if isMaxBytesError(err) {
+		err = ErrUploadTooLarge
+	}
+	switch err {
+	case ErrFileTooLarge, ErrUploadTooLarge, ErrTooManyFiles, ErrFileTypeNotAllowed:
+		return &UploadError{Field: part.FormName(), FileName: part.FileName(), Err: err}
+	}
+	return err
+}
+
+// isMaxBytesError returns true when the body is larger than NapNap.MaxRequestBodySize.
+func isMaxBytesError(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// limitCounter counts the bytes which are written and fails when the limit is exceeded.
+type limitCounter struct {
+	n     int64
+	limit int64
+	err   error
+}
+
+type limitError struct {
+	err error
+}
+
+func (e *limitError) Error() string {
+	return e.err.Error()
+}
+
+func (lc *limitCounter) Write(p []byte) (int, error) {
+	lc.n += int64(len(p))
+	if lc.limit > 0 && lc.n > lc.limit {
+		return 0, &limitError{err: lc.err}
+	}
+	return len(p), nil
+}
+
+func isAllowedType(contentType string, allowedTypes []string) bool {
+	if len(allowedTypes) == 0 {
+		return true
+	}
+	contentType = filterFlags(contentType)
+	for _, allowed := range allowedTypes {
+		if allowed == contentType || allowed == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(contentType, allowed[:len(allowed)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeExt keeps the extension only if it is short and contains letters and digits only.
+func sanitizeExt(ext string) string {
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, char := range ext[1:] {
+		if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')) {
+			return ""
+		}
+	}
+	return strings.ToLower(ext)
+}
@@ -0,0 +1,136 @@
+package napnap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPNG = append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), bytes.Repeat([]byte("a"), 100)...)
+
+type testPart struct {
+	field    string
+	fileName string
+	content  []byte
+}
+
+func newUploadContext(parts ...testPart) *Context {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for _, part := range parts {
+		if len(part.fileName) > 0 {
+			w, _ := mw.CreateFormFile(part.field, part.fileName)
+			_, _ = w.Write(part.content)
+		} else {
+			_ = mw.WriteField(part.field, string(part.content))
+		}
+	}
+	_ = mw.Close()
+
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("POST", "/upload", body)
+	c.Request.Header.Set("Content-Type", mw.FormDataContentType())
+	return c
+}
+
+func TestContextReceiveFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalFileStore(dir)
+	assert.Nil(t, err)
+
+	c := newUploadContext(
+		testPart{field: "title", content: []byte("holiday")},
+		testPart{field: "photo", fileName: "../../beach.PNG", content: testPNG},
+	)
+	result, err := c.ReceiveFiles(&UploadOptions{Store: store, AllowedTypes: []string{"image/*"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "holiday", result.Fields.Get("title"))
+	assert.Len(t, result.Files, 1)
+
+	file := result.Files[0]
+	sum := sha256.Sum256(testPNG)
+	assert.Equal(t, "photo", file.Field)
+	assert.Equal(t, "image/png", file.ContentType)
+	assert.Equal(t, int64(len(testPNG)), file.Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), file.Hash)
+	assert.Regexp(t, `^[0-9a-f]{32}\.png$`, file.Key)
+
+	content, err := os.ReadFile(store.Path(file.Key))
+	assert.Nil(t, err)
+	assert.Equal(t, testPNG, content)
+}
+
+func TestContextReceiveFilesLimits(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewLocalFileStore(dir)
+
+	var uploadErr *UploadError
+
+	// the type is sniffed from the content instead of the file name
+	c := newUploadContext(testPart{field: "photo", fileName: "photo.png", content: []byte("<html><body>hi</body></html>")})
+	_, err := c.ReceiveFiles(&UploadOptions{Store: store, AllowedTypes: []string{"image/png"}})
+	assert.True(t, errors.As(err, &uploadErr))
+	assert.Equal(t, ErrFileTypeNotAllowed, uploadErr.Err)
+	assert.Equal(t, http.StatusUnsupportedMediaType, uploadErr.StatusCode())
+
+	c = newUploadContext(testPart{field: "photo", fileName: "photo.png", content: testPNG})
+	_, err = c.ReceiveFiles(&UploadOptions{Store: store, MaxFileSize: 50})
+	assert.True(t, errors.As(err, &uploadErr))
+	assert.Equal(t, ErrFileTooLarge, uploadErr.Err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, uploadErr.StatusCode())
+
+	// files which were already stored are removed when a later part fails
+	c = newUploadContext(
+		testPart{field: "a", fileName: "a.png", content: testPNG},
+		testPart{field: "b", fileName: "b.png", content: testPNG},
+	)
+	_, err = c.ReceiveFiles(&UploadOptions{Store: store, MaxTotalSize: int64(len(testPNG)) + 10})
+	assert.True(t, errors.As(err, &uploadErr))
+	assert.Equal(t, ErrUploadTooLarge, uploadErr.Err)
+	assert.Equal(t, "b", uploadErr.Field)
+
+	c = newUploadContext(
+		testPart{field: "a", fileName: "a.png", content: testPNG},
+		testPart{field: "b", fileName: "b.png", content: testPNG},
+	)
+	_, err = c.ReceiveFiles(&UploadOptions{Store: store, MaxFiles: 1})
+	assert.True(t, errors.As(err, &uploadErr))
+	assert.Equal(t, ErrTooManyFiles, uploadErr.Err)
+
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
+
+func TestContextReceiveFilesMaxRequestBodySize(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewLocalFileStore(dir)
+
+	nap := New()
+	nap.MaxRequestBodySize = 200
+	var uploadErr *UploadError
+	nap.Post("/upload", func(c *Context) error {
+		_, err := c.ReceiveFiles(&UploadOptions{Store: store})
+		assert.True(t, errors.As(err, &uploadErr))
+		return err
+	})
+
+	upload := newUploadContext(
+		testPart{field: "a", fileName: "a.png", content: testPNG},
+		testPart{field: "b", fileName: "b.png", content: testPNG},
+	)
+	w := httptest.NewRecorder()
+	nap.ServeHTTP(w, upload.Request)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, ErrUploadTooLarge, uploadErr.Err)
+
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
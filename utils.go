@@ -1,5 +1,16 @@
 package napnap
 
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// jsonStreamFlushSize is the number of elements written between two flushes in JSONStream
+	jsonStreamFlushSize = 100
+)
+
 func filterFlags(content string) string {
 	for i, char := range content {
 		if char == ' ' || char == ';' {
@@ -8,3 +19,106 @@ func filterFlags(content string) string {
 	}
 	return content
 }
+
+// isValidCallback reports whether the name is a valid javascript identifier which can be used as a jsonp callback.
+// Dots are allowed, so `jQuery.callbacks.cb` is valid.
+func isValidCallback(name string) bool {
+	if len(name) == 0 || len(name) > 128 {
+		return false
+	}
+	start := true
+	for _, char := range name {
+		switch {
+		case char == '.':
+			if start {
+				return false
+			}
+			start = true
+			continue
+		case char == '_' || char == '$' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z'):
+		case char >= '0' && char <= '9':
+			if start {
+				return false
+			}
+		default:
+			return false
+		}
+		start = false
+	}
+	return !start
+}
+
+// asciiEscape escapes all non-ascii characters of json content to `\uXXXX`
+func asciiEscape(content []byte) []byte {
+	result := make([]byte, 0, len(content))
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		content = content[size:]
+		if r < utf8.RuneSelf {
+			result = append(result, byte(r))
+			continue
+		}
+		if r > 0xFFFF {
+			// characters outside the basic multilingual plane are encoded as utf-16 surrogate pairs
+			r -= 0x10000
+			result = appendUnicodeEscape(result, 0xD800+(r>>10))
+			result = appendUnicodeEscape(result, 0xDC00+(r&0x3FF))
+			continue
+		}
+		result = appendUnicodeEscape(result, r)
+	}
+	return result
+}
+
+func appendUnicodeEscape(dst []byte, r rune) []byte {
+	hex := strconv.FormatInt(int64(r), 16)
+	dst = append(dst, '\\', 'u')
+	for i := len(hex); i < 4; i++ {
+		dst = append(dst, '0')
+	}
+	return append(dst, hex...)
+}
+
+// encodeContentDisposition returns the Content-Disposition header value which follows RFC 6266.
+// Non-ascii file names are encoded with RFC 5987 and an ascii fallback is provided for old clients.
+func encodeContentDisposition(dispositionType, filename string) string {
+	needEncoding := false
+	var fallback strings.Builder
+	for _, char := range filename {
+		switch {
+		case char >= utf8.RuneSelf:
+			needEncoding = true
+			fallback.WriteByte('_')
+		case char == '"' || char == '\\' || char < ' ' || char == 0x7f:
+			needEncoding = true
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(char)
+		}
+	}
+
+	result := dispositionType + `; filename="` + fallback.String() + `"`
+	if !needEncoding {
+		return result
+	}
+
+	var sb strings.Builder
+	for _, b := range []byte(filename) {
+		if isAttrChar(b) {
+			sb.WriteByte(b)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte("0123456789ABCDEF"[b>>4])
+		sb.WriteByte("0123456789ABCDEF"[b&15])
+	}
+	return result + "; filename*=UTF-8''" + sb.String()
+}
+
+// isAttrChar reports whether the byte is an attr-char of RFC 5987 which doesn't need percent encoding.
+func isAttrChar(b byte) bool {
+	if (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
@@ -0,0 +1,872 @@
+package napnap
+
+// reference:
+// https://tools.ietf.org/html/rfc6455
+// https://tools.ietf.org/html/rfc7692
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// WebSocket close codes which are defined in RFC 6455, section 11.7.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+	CloseTLSHandshake            = 1015
+)
+
+const (
+	websocketGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxControlPayload    = 125
+	defaultWSReadLimit   = 32 << 20
+	defaultWSCloseWait   = 5 * time.Second
+	permessageDeflate    = "permessage-deflate"
+	deflateResponseParam = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+)
+
+var (
+	// ErrWebSocketClosed is returned when writing to a websocket connection which has been closed.
+	ErrWebSocketClosed = errors.New("napnap: websocket connection was closed")
+	// ErrBadHandshake is returned when the websocket handshake failed.
+	ErrBadHandshake = errors.New("napnap: bad websocket handshake")
+
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+	// an empty final stored block which makes the flate reader return io.EOF
+	deflateFinalBlock = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+)
+
+// CloseError is returned when the peer closed the websocket connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return "napnap: websocket closed with code " + strconv.Itoa(e.Code) + " " + e.Reason
+}
+
+// WebSocketOptions configures the websocket handshake and connection.
+type WebSocketOptions struct {
+	// Subprotocols lists the supported subprotocols in order of preference.
+	Subprotocols []string
+	// EnableCompression negotiates the permessage-deflate extension with the peer.
+	EnableCompression bool
+	// CompressionLevel is the flate compression level.  Default value is flate.BestSpeed
+	CompressionLevel int
+	// CheckOrigin returns true if the request Origin header is acceptable.
+	// If it is nil, only requests without origin or with the same origin as the host are accepted.
+	CheckOrigin func(r *http.Request) bool
+	// ReadLimit is the maximum size in bytes for a message read from the peer.  Default value is 32MB
+	ReadLimit int64
+	// FragmentSize splits outgoing messages into frames which are not larger than the size.
+	// Default value is 0 which means messages are never fragmented.
+	FragmentSize int
+	// Header is the additional header which is sent during the handshake.
+	Header http.Header
+}
+
+func (opts *WebSocketOptions) readLimit() int64 {
+	if opts.ReadLimit > 0 {
+		return opts.ReadLimit
+	}
+	return defaultWSReadLimit
+}
+
+func (opts *WebSocketOptions) compressionLevel() int {
+	if opts.CompressionLevel == 0 {
+		return flate.BestSpeed
+	}
+	return opts.CompressionLevel
+}
+
+// WebSocketConn represents a websocket connection.
+type WebSocketConn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	isServer    bool
+	subprotocol string
+	compress    bool
+	level       int
+	readLimit   int64
+	fragment    int
+
+	writeMu   sync.Mutex
+	closeSent bool
+
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+}
+
+func newWebSocketConn(conn net.Conn, br *bufio.Reader, isServer bool, opts *WebSocketOptions) *WebSocketConn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	ws := &WebSocketConn{
+		conn:      conn,
+		br:        br,
+		isServer:  isServer,
+		level:     opts.compressionLevel(),
+		readLimit: opts.readLimit(),
+		fragment:  opts.FragmentSize,
+	}
+	ws.pingHandler = func(data []byte) error {
+		err := ws.WriteControl(PongMessage, data)
+		if err == ErrWebSocketClosed {
+			return nil
+		}
+		return err
+	}
+	ws.pongHandler = func([]byte) error { return nil }
+	return ws
+}
+
+// WebSocket upgrades the HTTP connection to the websocket protocol with the default options.
+func (c *Context) WebSocket() (*WebSocketConn, error) {
+	return c.UpgradeWebSocket(&WebSocketOptions{EnableCompression: true})
+}
+
+// UpgradeWebSocket upgrades the HTTP connection to the websocket protocol.
+// If the handshake fails, an error response is sent to the client and ErrBadHandshake is returned.
+func (c *Context) UpgradeWebSocket(opts *WebSocketOptions) (*WebSocketConn, error) {
+	if opts == nil {
+		opts = &WebSocketOptions{}
+	}
+	req := c.Request
+
+	if req.Method != GET {
+		return nil, c.rejectWebSocket(405, "websocket: method is not GET")
+	}
+	if !headerContainsToken(req.Header, "Connection", "upgrade") {
+		return nil, c.rejectWebSocket(400, "websocket: 'upgrade' token not found in 'Connection' header")
+	}
+	if !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return nil, c.rejectWebSocket(400, "websocket: 'websocket' token not found in 'Upgrade' header")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		c.Writer.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, c.rejectWebSocket(426, "websocket: unsupported version")
+	}
+	key := strings.TrimSpace(req.Header.Get("Sec-WebSocket-Key"))
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, c.rejectWebSocket(400, "websocket: invalid 'Sec-WebSocket-Key' header")
+	}
+	checkOrigin := opts.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = isSameOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, c.rejectWebSocket(403, "websocket: origin is not allowed")
+	}
+
+	subprotocol := selectSubprotocol(req.Header, opts.Subprotocols)
+	compress := opts.EnableCompression && acceptDeflateOffer(req.Header)
+
+	netConn, brw, err := http.NewResponseController(c.Writer).Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil, c.rejectWebSocket(500, "websocket: response writer doesn't support hijacking")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	sb.WriteString(computeAcceptKey(key))
+	sb.WriteString("\r\n")
+	if len(subprotocol) > 0 {
+		sb.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		sb.WriteString("Sec-WebSocket-Extensions: " + deflateResponseParam + "\r\n")
+	}
+	for k, values := range opts.Header {
+		for _, v := range values {
+			sb.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	sb.WriteString("\r\n")
+
+	// the handshake must not take forever
+	_ = netConn.SetWriteDeadline(time.Now().Add(defaultWSCloseWait))
+	if _, err = netConn.Write([]byte(sb.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	_ = netConn.SetWriteDeadline(time.Time{})
+
+	ws := newWebSocketConn(netConn, brw.Reader, true, opts)
+	ws.subprotocol = subprotocol
+	ws.compress = compress
+	return ws, nil
+}
+
+func (c *Context) rejectWebSocket(code int, reason string) error {
+	if c.NapNap.debugEnabled() {
+		c.Logger().Debug("napnap: websocket handshake was rejected", "reason", reason)
+	}
+	_ = c.String(code, http.StatusText(code))
+	return ErrBadHandshake
+}
+
+// WebSocket registers a websocket endpoint.  The connection is closed with a normal closure when the handler returns nil,
+// otherwise it is closed with an internal error code.
+func (nap *NapNap) WebSocket(path string, handler func(conn *WebSocketConn) error) {
+	nap.router.Add(GET, path, func(c *Context) error {
+		conn, err := c.WebSocket()
+		if err == ErrBadHandshake {
+			// the error response has already been sent
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		err = handler(conn)
+		if err != nil {
+			var closeErr *CloseError
+			if errors.As(err, &closeErr) {
+				return nil
+			}
+			reason := err.Error()
+			if len(reason) > maxControlPayload-2 {
+				reason = reason[:maxControlPayload-2]
+			}
+			_ = conn.CloseWithCode(CloseInternalServerErr, reason)
+			return nil
+		}
+		_ = conn.CloseWithCode(CloseNormalClosure, "")
+		return nil
+	})
+}
+
+// DialWebSocket connects to a websocket server.  It is mainly designed for testing a napnap application which is served
+// by httptest.Server, so both `ws://` and `http://` urls are accepted.  TLS isn't supported.
+func DialWebSocket(rawurl string, opts *WebSocketOptions) (*WebSocketConn, *http.Response, error) {
+	if opts == nil {
+		opts = &WebSocketOptions{}
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch u.Scheme {
+	case "ws", "http":
+	default:
+		return nil, nil, fmt.Errorf("napnap: unsupported websocket url scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if len(u.Port()) == 0 {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	netConn, err := net.Dial("tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err = rand.Read(keyBytes); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	u.Scheme = "http"
+	req, _ := http.NewRequest(GET, u.String(), nil)
+	for k, values := range opts.Header {
+		req.Header[k] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if len(opts.Subprotocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(opts.Subprotocols, ", "))
+	}
+	if opts.EnableCompression {
+		req.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate; client_no_context_takeover; server_no_context_takeover")
+	}
+
+	if err = req.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != 101 ||
+		!headerContainsToken(resp.Header, "Upgrade", "websocket") ||
+		!headerContainsToken(resp.Header, "Connection", "upgrade") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != computeAcceptKey(key) {
+		netConn.Close()
+		return nil, resp, ErrBadHandshake
+	}
+
+	ws := newWebSocketConn(netConn, br, false, opts)
+	ws.subprotocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	for _, ext := range parseExtensions(resp.Header) {
+		if ext.name == permessageDeflate {
+			ws.compress = true
+		}
+	}
+	return ws, resp, nil
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (ws *WebSocketConn) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// CompressionEnabled reports whether the permessage-deflate extension was negotiated.
+func (ws *WebSocketConn) CompressionEnabled() bool {
+	return ws.compress
+}
+
+// RemoteAddr returns the remote network address.
+func (ws *WebSocketConn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// SetReadLimit sets the maximum size in bytes for a message read from the peer.
+func (ws *WebSocketConn) SetReadLimit(limit int64) {
+	ws.readLimit = limit
+}
+
+// SetReadDeadline sets the read deadline on the underlying network connection.
+func (ws *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline on the underlying network connection.
+func (ws *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+// SetPingHandler sets the handler for ping messages.  The default handler replies a pong message with the same payload.
+func (ws *WebSocketConn) SetPingHandler(h func(data []byte) error) {
+	ws.pingHandler = h
+}
+
+// SetPongHandler sets the handler for pong messages.
+func (ws *WebSocketConn) SetPongHandler(h func(data []byte) error) {
+	ws.pongHandler = h
+}
+
+// ReadMessage reads the next data message from the peer.  Control messages are handled while reading.
+// A *CloseError is returned when the peer closed the connection.
+func (ws *WebSocketConn) ReadMessage() (int, []byte, error) {
+	var (
+		messageType int
+		compressed  bool
+		message     []byte
+	)
+
+	for {
+		fin, rsv1, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err = ws.pingHandler(payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if err = ws.pongHandler(payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, ws.handleClose(payload)
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+			if rsv1 {
+				return 0, nil, ws.fail(CloseProtocolError, "rsv1 set on continuation frame")
+			}
+		default:
+			if messageType != 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "expected continuation frame")
+			}
+			messageType = opcode
+			compressed = rsv1
+		}
+
+		if int64(len(message)+len(payload)) > ws.readLimit {
+			return 0, nil, ws.fail(CloseMessageTooBig, "message is too big")
+		}
+		message = append(message, payload...)
+
+		if !fin {
+			continue
+		}
+
+		if compressed {
+			message, err = ws.decompress(message)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, ws.fail(CloseInvalidFramePayloadData, "invalid utf-8 in text message")
+		}
+		return messageType, message, nil
+	}
+}
+
+// ReadJSON reads the next message from the peer and decodes it into `obj`.
+func (ws *WebSocketConn) ReadJSON(obj interface{}) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// WriteMessage writes a text or binary message to the peer.
+func (ws *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("napnap: invalid websocket message type %d", messageType)
+	}
+
+	rsv1 := false
+	if ws.compress {
+		compressed, err := ws.deflate(data)
+		if err != nil {
+			return err
+		}
+		data = compressed
+		rsv1 = true
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+
+	opcode := messageType
+	for {
+		chunk := data
+		if ws.fragment > 0 && len(chunk) > ws.fragment {
+			chunk = chunk[:ws.fragment]
+		}
+		data = data[len(chunk):]
+		fin := len(data) == 0
+
+		if err := ws.writeFrame(fin, rsv1, opcode, chunk); err != nil {
+			return err
+		}
+		if fin {
+			return nil
+		}
+		opcode = continuationFrame
+		rsv1 = false
+	}
+}
+
+// WriteJSON encodes `obj` as json and writes it as a text message.
+func (ws *WebSocketConn) WriteJSON(obj interface{}) error {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(TextMessage, b)
+}
+
+// WriteControl writes a ping or pong message to the peer.
+func (ws *WebSocketConn) WriteControl(messageType int, data []byte) error {
+	if messageType != PingMessage && messageType != PongMessage {
+		return fmt.Errorf("napnap: invalid websocket control message type %d", messageType)
+	}
+	if len(data) > maxControlPayload {
+		return errors.New("napnap: websocket control message is too big")
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+	return ws.writeFrame(true, false, messageType, data)
+}
+
+// Ping sends a ping message to the peer.
+func (ws *WebSocketConn) Ping(data []byte) error {
+	return ws.WriteControl(PingMessage, data)
+}
+
+// CloseWithCode sends a close message with the code and reason to the peer.  It doesn't close the underlying connection,
+// so the close message of the peer can still be read.
+func (ws *WebSocketConn) CloseWithCode(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		return errors.New("napnap: websocket close reason is too long")
+	}
+	return ws.writeClose(payload)
+}
+
+// Close sends a normal closure message if no close message was sent yet and closes the underlying connection.
+func (ws *WebSocketConn) Close() error {
+	_ = ws.CloseWithCode(CloseNormalClosure, "")
+	return ws.conn.Close()
+}
+
+func (ws *WebSocketConn) writeClose(payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+	ws.closeSent = true
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(defaultWSCloseWait))
+	return ws.writeFrame(true, false, CloseMessage, payload)
+}
+
+func (ws *WebSocketConn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return ws.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !isValidCloseCode(closeErr.Code) {
+			return ws.fail(CloseProtocolError, "invalid close code")
+		}
+		if !utf8.Valid(payload[2:]) {
+			return ws.fail(CloseInvalidFramePayloadData, "invalid utf-8 in close reason")
+		}
+	}
+
+	// echo the close code back as RFC 6455 section 5.5.1 requires
+	var reply []byte
+	if len(payload) >= 2 {
+		reply = payload[:2]
+	}
+	_ = ws.writeClose(reply)
+	return closeErr
+}
+
+// fail sends a close message to the peer because of a protocol violation and returns the error.
+func (ws *WebSocketConn) fail(code int, reason string) error {
+	_ = ws.CloseWithCode(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (ws *WebSocketConn) readFrame() (fin, rsv1 bool, opcode int, payload []byte, err error) {
+	var header [8]byte
+	if _, err = io.ReadFull(ws.br, header[:2]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	rsv1 = header[0]&0x40 != 0
+	opcode = int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	if header[0]&0x30 != 0 || (rsv1 && !ws.compress) {
+		err = ws.fail(CloseProtocolError, "unexpected reserved bits")
+		return
+	}
+	switch opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !fin || length > maxControlPayload || rsv1 {
+			err = ws.fail(CloseProtocolError, "invalid control frame")
+			return
+		}
+	default:
+		err = ws.fail(CloseProtocolError, "unknown opcode "+strconv.Itoa(opcode))
+		return
+	}
+	// frames sent from client to server must be masked and frames sent from server must not
+	if masked != ws.isServer {
+		err = ws.fail(CloseProtocolError, "invalid frame masking")
+		return
+	}
+
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(ws.br, header[:2]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err = io.ReadFull(ws.br, header[:8]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(header[:8])
+		if length>>63 != 0 {
+			err = ws.fail(CloseProtocolError, "invalid frame length")
+			return
+		}
+	}
+	if length > uint64(ws.readLimit) {
+		err = ws.fail(CloseMessageTooBig, "message is too big")
+		return
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err = io.ReadFull(ws.br, maskKey[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.br, payload); err != nil {
+		return
+	}
+	if masked {
+		maskBytes(maskKey, payload)
+	}
+	return
+}
+
+// writeFrame writes a single frame.  The caller must hold writeMu.
+func (ws *WebSocketConn) writeFrame(fin, rsv1 bool, opcode int, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	if rsv1 {
+		b0 |= 0x40
+	}
+	frame = append(frame, b0)
+
+	var maskBit byte
+	if !ws.isServer {
+		maskBit = 0x80
+	}
+	length := len(payload)
+	switch {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, maskBit|127)
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(length))
+		frame = append(frame, ext[:]...)
+	}
+
+	if ws.isServer {
+		frame = append(frame, payload...)
+	} else {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return err
+		}
+		frame = append(frame, maskKey[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(maskKey, frame[start:])
+	}
+
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+func (ws *WebSocketConn) deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, ws.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = fw.Flush(); err != nil {
+		return nil, err
+	}
+	// RFC 7692 section 7.2.1: remove the trailing 0x00 0x00 0xff 0xff of the sync flush
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail), nil
+}
+
+func (ws *WebSocketConn) decompress(data []byte) ([]byte, error) {
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail), bytes.NewReader(deflateFinalBlock)))
+	defer fr.Close()
+
+	result, err := ioutil.ReadAll(io.LimitReader(fr, ws.readLimit+1))
+	if err != nil {
+		return nil, ws.fail(CloseInvalidFramePayloadData, "invalid compressed data")
+	}
+	if int64(len(result)) > ws.readLimit {
+		return nil, ws.fail(CloseMessageTooBig, "message is too big")
+	}
+	return result, nil
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+func computeAcceptKey(key string) string {
+	h := sha1.New()
+	_, _ = h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func isValidCloseCode(code int) bool {
+	switch code {
+	case CloseNormalClosure, CloseGoingAway, CloseProtocolError, CloseUnsupportedData,
+		CloseInvalidFramePayloadData, ClosePolicyViolation, CloseMessageTooBig,
+		CloseMandatoryExtension, CloseInternalServerErr:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+// headerContainsToken reports whether the comma separated header contains the token.  The comparison is case insensitive.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func selectSubprotocol(header http.Header, supported []string) string {
+	for _, s := range supported {
+		for _, value := range header["Sec-Websocket-Protocol"] {
+			for _, requested := range strings.Split(value, ",") {
+				if strings.TrimSpace(requested) == s {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
+
+type extension struct {
+	name   string
+	params map[string]string
+}
+
+func parseExtensions(header http.Header) []extension {
+	var result []extension
+	for _, value := range header["Sec-Websocket-Extensions"] {
+		for _, item := range strings.Split(value, ",") {
+			parts := strings.Split(item, ";")
+			ext := extension{
+				name:   strings.ToLower(strings.TrimSpace(parts[0])),
+				params: map[string]string{},
+			}
+			if len(ext.name) == 0 {
+				continue
+			}
+			for _, p := range parts[1:] {
+				kv := strings.SplitN(p, "=", 2)
+				key := strings.ToLower(strings.TrimSpace(kv[0]))
+				val := ""
+				if len(kv) == 2 {
+					val = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+				}
+				ext.params[key] = val
+			}
+			result = append(result, ext)
+		}
+	}
+	return result
+}
+
+// acceptDeflateOffer reports whether one of the permessage-deflate offers can be accepted.
+// compress/flate always uses a 32KB window, so offers which limit the server window are declined.
+func acceptDeflateOffer(header http.Header) bool {
+	for _, ext := range parseExtensions(header) {
+		if ext.name != permessageDeflate {
+			continue
+		}
+		acceptable := true
+		for key, val := range ext.params {
+			switch key {
+			case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				if val != "15" {
+					acceptable = false
+				}
+			default:
+				acceptable = false
+			}
+		}
+		if acceptable {
+			return true
+		}
+	}
+	return false
+}
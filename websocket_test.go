@@ -0,0 +1,144 @@
+package napnap
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newEchoServer() *httptest.Server {
+	nap := New()
+	nap.WebSocket("/ws", func(conn *WebSocketConn) error {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return err
+			}
+			if string(data) == "fail" {
+				return errors.New("oops")
+			}
+			if err = conn.WriteMessage(messageType, data); err != nil {
+				return err
+			}
+		}
+	})
+	return httptest.NewServer(nap)
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	ts := newEchoServer()
+	defer ts.Close()
+
+	conn, resp, err := DialWebSocket(ts.URL+"/ws", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 101, resp.StatusCode)
+	assert.False(t, conn.CompressionEnabled())
+	defer conn.Close()
+
+	assert.Nil(t, conn.WriteMessage(TextMessage, []byte("hello")))
+	messageType, data, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, TextMessage, messageType)
+	assert.Equal(t, "hello", string(data))
+
+	payload := bytes.Repeat([]byte{0x01, 0xff}, 70000)
+	assert.Nil(t, conn.WriteMessage(BinaryMessage, payload))
+	messageType, data, err = conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, BinaryMessage, messageType)
+	assert.Equal(t, payload, data)
+}
+
+func TestWebSocketCompressionAndFragmentation(t *testing.T) {
+	ts := newEchoServer()
+	defer ts.Close()
+
+	conn, _, err := DialWebSocket(ts.URL+"/ws", &WebSocketOptions{EnableCompression: true, FragmentSize: 7})
+	assert.Nil(t, err)
+	assert.True(t, conn.CompressionEnabled())
+	defer conn.Close()
+
+	message := strings.Repeat("napnap websocket ", 100)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, conn.WriteMessage(TextMessage, []byte(message)))
+		_, data, err := conn.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, message, string(data))
+	}
+}
+
+func TestWebSocketPingPong(t *testing.T) {
+	ts := newEchoServer()
+	defer ts.Close()
+
+	conn, _, err := DialWebSocket(ts.URL+"/ws", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	pong := make(chan string, 1)
+	conn.SetPongHandler(func(data []byte) error {
+		pong <- string(data)
+		return nil
+	})
+
+	assert.Nil(t, conn.Ping([]byte("are you there")))
+	assert.Nil(t, conn.WriteMessage(TextMessage, []byte("hi")))
+	_, data, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "hi", string(data))
+	assert.Equal(t, "are you there", <-pong)
+}
+
+func TestWebSocketCloseCodes(t *testing.T) {
+	ts := newEchoServer()
+	defer ts.Close()
+
+	conn, _, err := DialWebSocket(ts.URL+"/ws", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	assert.Nil(t, conn.WriteMessage(TextMessage, []byte("fail")))
+	_, _, err = conn.ReadMessage()
+	closeErr, ok := err.(*CloseError)
+	assert.True(t, ok)
+	assert.Equal(t, CloseInternalServerErr, closeErr.Code)
+	assert.Equal(t, "oops", closeErr.Reason)
+
+	conn, _, err = DialWebSocket(ts.URL+"/ws", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	assert.Nil(t, conn.CloseWithCode(4000, "bye"))
+	_, _, err = conn.ReadMessage()
+	closeErr, ok = err.(*CloseError)
+	assert.True(t, ok)
+	assert.Equal(t, 4000, closeErr.Code)
+}
+
+func TestWebSocketBadHandshake(t *testing.T) {
+	ts := newEchoServer()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/ws")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+
+	req, _ := http.NewRequest("GET", ts.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 426, resp.StatusCode)
+	assert.Equal(t, "13", resp.Header.Get("Sec-WebSocket-Version"))
+
+	_, _, err = DialWebSocket(ts.URL+"/ws", &WebSocketOptions{Header: http.Header{"Origin": []string{"http://evil.com"}}})
+	assert.Equal(t, ErrBadHandshake, err)
+}